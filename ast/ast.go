@@ -2,14 +2,35 @@ package ast
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wangkekekexili/mankey/token"
 )
 
 type Node interface {
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the node
 	String() string
 }
 
+// Span records the source range of a node. It is embedded in every node.
+type Span struct {
+	Start token.Position
+	Stop  token.Position
+}
+
+func (s Span) Pos() token.Position {
+	return s.Start
+}
+
+func (s Span) End() token.Position {
+	return s.Stop
+}
+
 type Statement interface {
 	Node
 }
@@ -18,8 +39,17 @@ type Expression interface {
 	Node
 }
 
+// Identifier is a name. The resolver binds it to the variable it refers to:
+// if Local is set, the variable is in slot Slot of the frame of the function
+// Depth levels out from the function the identifier is in. Otherwise, it is a
+// global looked up by name.
 type Identifier struct {
+	Span
 	Value string
+
+	Local bool `ast:"analysis"`
+	Depth int  `ast:"analysis"`
+	Slot  int  `ast:"analysis"`
 }
 
 func (i *Identifier) String() string {
@@ -27,7 +57,9 @@ func (i *Identifier) String() string {
 }
 
 type Program struct {
+	Span
 	Statements []Statement
+	Resolved   bool `ast:"analysis"` // set by the resolver once the identifiers are bound
 }
 
 func (p *Program) String() string {
@@ -39,6 +71,7 @@ func (p *Program) String() string {
 }
 
 type BlockStatement struct {
+	Span
 	Statements []Statement
 }
 
@@ -53,6 +86,7 @@ func (b *BlockStatement) String() string {
 }
 
 type VarStatement struct {
+	Span
 	Name  *Identifier
 	Value Expression
 }
@@ -62,6 +96,7 @@ func (s *VarStatement) String() string {
 }
 
 type ReturnStatement struct {
+	Span
 	Value Expression
 }
 
@@ -69,15 +104,92 @@ func (s *ReturnStatement) String() string {
 	return fmt.Sprintf("return %v;", s.Value)
 }
 
+// AssignStatement assigns Value to Target, which is an *Identifier or an
+// *IndexExpression. Op is "=" or a compound operator such as "+=".
+type AssignStatement struct {
+	Span
+	Target Expression
+	Op     Operator
+	Value  Expression
+}
+
+func (s *AssignStatement) String() string {
+	return fmt.Sprintf("%v %s %v;", s.Target, s.Op, s.Value)
+}
+
+type WhileStatement struct {
+	Span
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (s *WhileStatement) String() string {
+	return fmt.Sprintf("while (%v) %v", s.Condition, s.Body)
+}
+
+// ForStatement is a C-style for loop. Init, Condition and Post may be nil.
+type ForStatement struct {
+	Span
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (s *ForStatement) String() string {
+	var init, cond, post string
+	if s.Init != nil {
+		init = strings.TrimSuffix(s.Init.String(), ";")
+	}
+	if s.Condition != nil {
+		cond = " " + s.Condition.String()
+	}
+	if s.Post != nil {
+		post = " " + strings.TrimSuffix(s.Post.String(), ";")
+	}
+	return fmt.Sprintf("for (%v;%v;%v) %v", init, cond, post, s.Body)
+}
+
+// ForInStatement loops over the elements of an array, the characters of a
+// string or the keys of a hash.
+type ForInStatement struct {
+	Span
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (s *ForInStatement) String() string {
+	return fmt.Sprintf("for (%v in %v) %v", s.Variable, s.Iterable, s.Body)
+}
+
+type BreakStatement struct {
+	Span
+}
+
+func (s *BreakStatement) String() string {
+	return "break;"
+}
+
+type ContinueStatement struct {
+	Span
+}
+
+func (s *ContinueStatement) String() string {
+	return "continue;"
+}
+
 type ExpressionStatement struct {
+	Span
 	Value Expression
 }
 
 func (s *ExpressionStatement) String() string {
-	return s.Value.String()
+	return s.Value.String() + ";"
 }
 
 type Boolean struct {
+	Span
 	Value bool
 }
 
@@ -86,6 +198,7 @@ func (b *Boolean) String() string {
 }
 
 type Integer struct {
+	Span
 	Value int64
 }
 
@@ -93,15 +206,67 @@ func (s *Integer) String() string {
 	return strconv.FormatInt(s.Value, 10)
 }
 
+type Float struct {
+	Span
+	Value float64
+}
+
+// String returns the value as a literal. Infinities and NaN, which have no
+// literal, are written as expressions that evaluate to them.
+func (f *Float) String() string {
+	switch {
+	case math.IsInf(f.Value, 1):
+		return (&InfixExpression{Left: &Float{Value: math.MaxFloat64}, Op: "*", Right: &Float{Value: 2}}).String()
+	case math.IsInf(f.Value, -1):
+		return (&PrefixExpression{Op: "-", Value: &Float{Value: math.Inf(1)}}).String()
+	case math.IsNaN(f.Value):
+		return (&InfixExpression{Left: &Float{Value: math.Inf(1)}, Op: "-", Right: &Float{Value: math.Inf(1)}}).String()
+	}
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
 type String struct {
+	Span
 	Value string
 }
 
+// String returns the value as a double-quoted literal. Quotes, backslashes,
+// control characters, invalid UTF-8 bytes and unprintable characters are
+// escaped.
 func (s *String) String() string {
-	return s.Value
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for i := 0; i < len(s.Value); {
+		r, size := utf8.DecodeRuneInString(s.Value[i:])
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == utf8.RuneError && size == 1, r < ' ', r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, s.Value[i])
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
 }
 
 type Array struct {
+	Span
 	Elements []Expression
 }
 
@@ -113,19 +278,29 @@ func (a *Array) String() string {
 	return "[" + strings.Join(strs, ",") + "]"
 }
 
+// HashPair is a key and its value in a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// Hash is a hash literal. Its pairs are in source order, which is the order
+// they are evaluated in.
 type Hash struct {
-	Value map[Expression]Expression
+	Span
+	Pairs []HashPair
 }
 
 func (h *Hash) String() string {
 	var strs []string
-	for k, v := range h.Value {
-		strs = append(strs, fmt.Sprintf("%v: %v", k, v))
+	for _, p := range h.Pairs {
+		strs = append(strs, fmt.Sprintf("%v: %v", p.Key, p.Value))
 	}
 	return "{" + strings.Join(strs, ",") + "}"
 }
 
 type IndexExpression struct {
+	Span
 	Left  Expression
 	Index Expression
 }
@@ -137,6 +312,7 @@ func (i *IndexExpression) String() string {
 type Operator string
 
 type PrefixExpression struct {
+	Span
 	Op    Operator
 	Value Expression
 }
@@ -146,6 +322,7 @@ func (p *PrefixExpression) String() string {
 }
 
 type InfixExpression struct {
+	Span
 	Left  Expression
 	Op    Operator
 	Right Expression
@@ -156,6 +333,7 @@ func (i *InfixExpression) String() string {
 }
 
 type IfExpression struct {
+	Span
 	Condition   Expression
 	Consequence *BlockStatement
 	Alternative *BlockStatement
@@ -170,8 +348,11 @@ func (i *IfExpression) String() string {
 }
 
 type Function struct {
+	Span
+	Name       string // set for a function literal bound by a var statement
 	Parameters []*Identifier
 	Body       *BlockStatement
+	NumSlots   int `ast:"analysis"` // number of locals, parameters first, set by the resolver
 }
 
 func (f *Function) String() string {
@@ -183,8 +364,10 @@ func (f *Function) String() string {
 }
 
 type CallExpression struct {
+	Span
 	Function  Expression
 	Arguments []Expression
+	Tail      bool `ast:"analysis"` // the call is in tail position in a function body
 }
 
 func (c *CallExpression) String() string {
@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Fprint writes node to w as an indented tree, one field per line, with the
+// source range of every node.
+func Fprint(w io.Writer, node Node) error {
+	p := &printer{w: w}
+	p.print(reflect.ValueOf(node), 0)
+	return p.err
+}
+
+// FprintSyntax is like Fprint, but leaves out the fields that are not part
+// of the source, such as the bindings set by the resolver.
+func FprintSyntax(w io.Writer, node Node) error {
+	p := &printer{w: w, syntax: true}
+	p.print(reflect.ValueOf(node), 0)
+	return p.err
+}
+
+type printer struct {
+	w      io.Writer
+	syntax bool // leave out the fields tagged `ast:"analysis"`
+	err    error
+}
+
+func (p *printer) printf(format string, a ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, a...)
+}
+
+var (
+	nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+	spanType = reflect.TypeOf(Span{})
+)
+
+// print writes v, which starts on the current line, and its children on the
+// following lines at the given depth.
+func (p *printer) print(v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth+1)
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			p.printf("nil\n")
+			return
+		}
+		if v.Type().Implements(nodeType) && v.Kind() == reflect.Ptr {
+			node := v.Interface().(Node)
+			p.printf("%v %v-%v\n", v.Elem().Type().Name(), node.Pos(), node.End())
+			p.printFields(v.Elem(), depth+1)
+			return
+		}
+		p.print(v.Elem(), depth)
+	case reflect.Slice:
+		p.printf("[%d]\n", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			p.printf("%v%d: ", indent, i)
+			p.print(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		p.printf("map[%d]\n", v.Len())
+		for _, k := range v.MapKeys() {
+			p.printf("%vkey: ", indent)
+			p.print(k, depth+1)
+			p.printf("%vvalue: ", indent)
+			p.print(v.MapIndex(k), depth+1)
+		}
+	case reflect.String:
+		p.printf("%q\n", v.String())
+	default:
+		p.printf("%v\n", v.Interface())
+	}
+}
+
+func (p *printer) printFields(v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type == spanType || f.PkgPath != "" || p.syntax && f.Tag.Get("ast") == "analysis" {
+			continue
+		}
+		p.printf("%v%v: ", indent, f.Name)
+		p.print(v.Field(i), depth)
+	}
+}
@@ -0,0 +1,75 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order, calling f
+// for each node. If f returns false, the children of the node are skipped.
+// Nil children are not visited.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		for _, stat := range n.Statements {
+			Inspect(stat, f)
+		}
+	case *BlockStatement:
+		for _, stat := range n.Statements {
+			Inspect(stat, f)
+		}
+	case *VarStatement:
+		Inspect(n.Name, f)
+		Inspect(n.Value, f)
+	case *ReturnStatement:
+		Inspect(n.Value, f)
+	case *AssignStatement:
+		Inspect(n.Target, f)
+		Inspect(n.Value, f)
+	case *WhileStatement:
+		Inspect(n.Condition, f)
+		Inspect(n.Body, f)
+	case *ForStatement:
+		Inspect(n.Init, f)
+		Inspect(n.Condition, f)
+		Inspect(n.Post, f)
+		Inspect(n.Body, f)
+	case *ForInStatement:
+		Inspect(n.Variable, f)
+		Inspect(n.Iterable, f)
+		Inspect(n.Body, f)
+	case *ExpressionStatement:
+		Inspect(n.Value, f)
+	case *Array:
+		for _, e := range n.Elements {
+			Inspect(e, f)
+		}
+	case *Hash:
+		for _, p := range n.Pairs {
+			Inspect(p.Key, f)
+			Inspect(p.Value, f)
+		}
+	case *IndexExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Index, f)
+	case *PrefixExpression:
+		Inspect(n.Value, f)
+	case *InfixExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *IfExpression:
+		Inspect(n.Condition, f)
+		Inspect(n.Consequence, f)
+		if n.Alternative != nil {
+			Inspect(n.Alternative, f)
+		}
+	case *Function:
+		for _, para := range n.Parameters {
+			Inspect(para, f)
+		}
+		Inspect(n.Body, f)
+	case *CallExpression:
+		Inspect(n.Function, f)
+		for _, argu := range n.Arguments {
+			Inspect(argu, f)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/wangkekekexili/mankey/ast"
+)
+
+// Instructions is a sequence of encoded instructions. An instruction is an
+// opcode followed by its operands, each encoded as a big endian uint16.
+type Instructions []byte
+
+// Opcode identifies the operation of an instruction.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constant [index]
+	OpNull                   // push null
+	OpTrue                   // push true
+	OpFalse                  // push false
+	OpPop                    // pop a value
+	OpPopN                   // pop [n] values
+	OpDup                    // push the value on top of the stack
+
+	OpBinary       // pop two operands and push the result of Operators[operator]
+	OpBinaryConst  // like OpBinary, with constant [index] as the right operand
+	OpLocalBinary  // like OpBinaryConst, with local [index] as the left operand
+	OpMinus        // negate the top value
+	OpBang         // invert the top value
+	OpAnd          // jump to [target] if the top value is false, or else pop it
+	OpOr           // jump to [target] if the top value is true, or else pop it
+	OpCheckLogical // check that the right operand of && or || is a boolean
+
+	OpJump        // jump to [target]
+	OpJumpIfFalse // pop a condition and jump to [target] if it is false
+	OpCheck       // check for cancellation at a loop iteration
+
+	OpGetGlobal  // push global [index]
+	OpSetGlobal  // pop a value into global [index]
+	OpGetLocal   // push local [index]
+	OpSetLocal   // pop a value into local [index]
+	OpGetCell    // push the value of the cell in local [index]
+	OpSetCell    // pop a value into the cell in local [index]
+	OpGetFree    // push the value of free variable [index]
+	OpSetFree    // pop a value into free variable [index]
+	OpLoadCell   // push the cell in local [index], to be captured by a closure
+	OpLoadFree   // push the cell of free variable [index], to be captured
+	OpAssignable // push the value of the variable [scope] [index] being assigned
+
+	OpClosure     // pop [n] cells and push a closure of constant [index]
+	OpCall        // call the function below [n] arguments
+	OpTailCall    // like OpCall, but reuse the frame for a call of the current function
+	OpReturnValue // return the top value from the current function
+
+	OpArray        // pop [n] elements and push an array of them
+	OpHash         // pop [n] keys and values and push a hash of them
+	OpHashKey      // check that the top value can be a hash key
+	OpIndex        // pop an index and a container and push the element
+	OpIndexCurrent // push the current element of the container and index on top, for an assignment
+	OpSetIndex     // pop a value, an index and a container, set the element and push the value
+
+	OpIter     // pop an iterable and push an iterator over its items
+	OpIterNext // push the next item of the iterator, or pop it and jump to [target]
+)
+
+// Definition describes an opcode.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:     {"OpConstant", []int{2}},
+	OpNull:         {"OpNull", nil},
+	OpTrue:         {"OpTrue", nil},
+	OpFalse:        {"OpFalse", nil},
+	OpPop:          {"OpPop", nil},
+	OpPopN:         {"OpPopN", []int{2}},
+	OpDup:          {"OpDup", nil},
+	OpBinary:       {"OpBinary", []int{2}},
+	OpBinaryConst:  {"OpBinaryConst", []int{2, 2}},
+	OpLocalBinary:  {"OpLocalBinary", []int{2, 2, 2}},
+	OpMinus:        {"OpMinus", nil},
+	OpBang:         {"OpBang", nil},
+	OpAnd:          {"OpAnd", []int{2}},
+	OpOr:           {"OpOr", []int{2}},
+	OpCheckLogical: {"OpCheckLogical", nil},
+	OpJump:         {"OpJump", []int{2}},
+	OpJumpIfFalse:  {"OpJumpIfFalse", []int{2}},
+	OpCheck:        {"OpCheck", nil},
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{2}},
+	OpSetLocal:     {"OpSetLocal", []int{2}},
+	OpGetCell:      {"OpGetCell", []int{2}},
+	OpSetCell:      {"OpSetCell", []int{2}},
+	OpGetFree:      {"OpGetFree", []int{2}},
+	OpSetFree:      {"OpSetFree", []int{2}},
+	OpLoadCell:     {"OpLoadCell", []int{2}},
+	OpLoadFree:     {"OpLoadFree", []int{2}},
+	OpAssignable:   {"OpAssignable", []int{2, 2}},
+	OpClosure:      {"OpClosure", []int{2, 2}},
+	OpCall:         {"OpCall", []int{2}},
+	OpTailCall:     {"OpTailCall", []int{2}},
+	OpReturnValue:  {"OpReturnValue", nil},
+	OpArray:        {"OpArray", []int{2}},
+	OpHash:         {"OpHash", []int{2}},
+	OpHashKey:      {"OpHashKey", nil},
+	OpIndex:        {"OpIndex", nil},
+	OpIndexCurrent: {"OpIndexCurrent", nil},
+	OpSetIndex:     {"OpSetIndex", nil},
+	OpIter:         {"OpIter", nil},
+	OpIterNext:     {"OpIterNext", []int{2}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Operators are the binary operators of OpBinary, indexed by its operand.
+var Operators = []ast.Operator{"+", "-", "*", "/", "<", "<=", ">", ">=", "==", "!="}
+
+// The operands of OpBinary for the operators.
+const (
+	OperatorAdd = iota
+	OperatorSub
+	OperatorMul
+	OperatorDiv
+	OperatorLT
+	OperatorLE
+	OperatorGT
+	OperatorGE
+	OperatorEQ
+	OperatorNE
+)
+
+func operatorIndex(op ast.Operator) (int, bool) {
+	for i, o := range Operators {
+		if o == op {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Make encodes an instruction. It returns nil if op is undefined or if an
+// operand does not fit in its width.
+func Make(op Opcode, operands ...int) Instructions {
+	def, ok := definitions[op]
+	if !ok || checkOperands(def, operands) != nil {
+		return nil
+	}
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	ins := make(Instructions, length)
+	ins[0] = byte(op)
+	offset := 1
+	for i, o := range operands {
+		binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		offset += def.OperandWidths[i]
+	}
+	return ins
+}
+
+// checkOperands reports the first of operands that does not fit in its
+// width in def.
+func checkOperands(def *Definition, operands []int) error {
+	for i, o := range operands {
+		if max := 1<<(8*uint(def.OperandWidths[i])) - 1; o < 0 || o > max {
+			return fmt.Errorf("operand %v of %v exceeds %v", o, def.Name, max)
+		}
+	}
+	return nil
+}
+
+// ReadOperands decodes the operands of an instruction defined by def from
+// ins, and returns them with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, w := range def.OperandWidths {
+		operands[i] = int(ReadUint16(ins[offset:]))
+		offset += w
+	}
+	return operands, offset
+}
+
+// ReadUint16 decodes an operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line prefixed with its
+// offset.
+func (ins Instructions) String() string {
+	var b strings.Builder
+	for i := 0; i < len(ins); {
+		def, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			fmt.Fprintf(&b, "ERROR: %v\n", err)
+			i++
+			continue
+		}
+		operands, n := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&b, "%04d %v", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&b, " %d", o)
+		}
+		b.WriteString("\n")
+		i += 1 + n
+	}
+	return b.String()
+}
@@ -0,0 +1,721 @@
+// Package compiler compiles programs into bytecode for the virtual machine
+// in package vm.
+//
+// Every statement compiles to code that leaves its value on the stack, so
+// that the value of a block is the value of its last statement as with the
+// evaluator. Blocks do not introduce scopes: the variables declared anywhere
+// in the body of a function, outside of nested functions, are the locals of
+// the function, and the variables declared at the top level of the program
+// are globals. The compiler uses the bindings of the identifiers set by
+// package resolver. Locals captured by a closure are stored in cells shared
+// with the closure.
+package compiler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/object"
+	"github.com/wangkekekexili/mankey/resolver"
+)
+
+// Bytecode is a compiled program.
+type Bytecode struct {
+	Main      *CompiledFunction // the top level of the program
+	Constants []object.Object
+	Globals   []string // the names of the globals, by index
+}
+
+const ObjCompiledFunction = "COMPILED_FUNCTION"
+
+// CompiledFunction is the code of a function or of the top level of a
+// program.
+type CompiledFunction struct {
+	Name       string // the name the function was declared with, if any
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+
+	Instructions Instructions
+	NumLocals    int   // number of locals, parameters first
+	MaxStack     int   // maximum number of values pushed above the locals
+	Cells        []int // indexes of the locals captured by closures
+
+	// Nodes are the nodes the instructions that may fail are compiled from,
+	// by offset, to report errors.
+	Nodes map[int]ast.Node
+}
+
+func (f *CompiledFunction) Type() object.ObjectType {
+	return ObjCompiledFunction
+}
+
+func (f *CompiledFunction) String() string {
+	if f.Body == nil {
+		return "compiled program"
+	}
+	fn := &object.Function{Parameters: f.Parameters, Body: f.Body}
+	return fn.String()
+}
+
+// Compile compiles program, which is resolved first unless it is resolved
+// already.
+func Compile(program *ast.Program) (*Bytecode, error) {
+	if !program.Resolved {
+		resolver.Resolve(program)
+	}
+	c := &Compiler{globalIndexes: make(map[string]int)}
+	c.scope = &compilation{
+		fn: &CompiledFunction{Nodes: make(map[int]ast.Node)},
+	}
+	if err := c.compileStatements(program.Statements); err != nil {
+		return nil, err
+	}
+	c.emit(OpReturnValue)
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(c.constants) > math.MaxUint16 || len(c.globals) > math.MaxUint16 ||
+		len(c.scope.fn.Instructions) > math.MaxUint16 {
+		return nil, fmt.Errorf("program too large to compile")
+	}
+	return &Bytecode{
+		Main:      c.finishScope(),
+		Constants: c.constants,
+		Globals:   c.globals,
+	}, nil
+}
+
+// Compiler holds the state of the compilation of a program.
+type Compiler struct {
+	constants     []object.Object
+	globals       []string       // the names of the globals, by index
+	globalIndexes map[string]int // the indexes of the globals, by name
+	scope         *compilation
+	err           error // the first operand that could not be encoded
+}
+
+// compilation is the state of the compilation of a function.
+type compilation struct {
+	fn       *CompiledFunction
+	captured map[int]bool   // the slots stored in cells
+	free     []freeVariable // the variables captured by the function, by index
+	depth    int            // number of values on the stack above the locals
+	loops    []*loop
+	outer    *compilation
+}
+
+// loop is a loop being compiled.
+type loop struct {
+	depth     int   // stack depth at the beginning of an iteration
+	breaks    []int // offsets of the jumps of break statements
+	continues []int // offsets of the jumps of continue statements
+}
+
+func (c *Compiler) finishScope() *CompiledFunction {
+	fn := c.scope.fn
+	c.scope = c.scope.outer
+	return fn
+}
+
+func (c *Compiler) compileStatements(stats []ast.Statement) error {
+	if len(stats) == 0 {
+		c.emit(OpNull)
+		return nil
+	}
+	for i, stat := range stats {
+		if err := c.compileStatement(stat, i == len(stats)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileStatement compiles stat into code that pushes its value if value
+// is set, or else leaves the stack as it is.
+func (c *Compiler) compileStatement(stat ast.Statement, value bool) error {
+	switch stat := stat.(type) {
+	case *ast.ExpressionStatement:
+		if err := c.compileExpression(stat.Value); err != nil {
+			return err
+		}
+		if !value {
+			c.emit(OpPop)
+		}
+		return nil
+	case *ast.VarStatement:
+		if err := c.compileExpression(stat.Value); err != nil {
+			return err
+		}
+		if value {
+			c.emit(OpDup)
+		}
+		c.store(c.symbol(stat.Name))
+		return nil
+	case *ast.ReturnStatement:
+		if err := c.compileExpression(stat.Value); err != nil {
+			return err
+		}
+		c.emit(OpReturnValue)
+		// The code that follows is unreachable, but compiled as if the
+		// statement had a value if needed.
+		if !value {
+			c.setDepth(c.scope.depth - 1)
+		}
+		return nil
+	case *ast.AssignStatement:
+		return c.compileAssignStatement(stat, value)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(stat, value)
+	case *ast.ForStatement:
+		return c.compileForStatement(stat, value)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(stat, value)
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		_, isContinue := stat.(*ast.ContinueStatement)
+		if err := c.compileBranch(stat, isContinue); err != nil {
+			return err
+		}
+		// Compiled as if the statement had a value if needed.
+		if value {
+			c.setDepth(c.scope.depth + 1)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%v: cannot compile %T", stat.Pos(), stat)
+	}
+}
+
+func (c *Compiler) compileAssignStatement(stat *ast.AssignStatement, value bool) error {
+	var op int
+	if stat.Op != "=" {
+		var ok bool
+		op, ok = operatorIndex(stat.Op[:len(stat.Op)-1])
+		if !ok {
+			return fmt.Errorf("%v: cannot compile operator %v", stat.Pos(), stat.Op)
+		}
+	}
+
+	switch target := stat.Target.(type) {
+	case *ast.Identifier:
+		sym := c.symbol(target)
+		c.emitNode(target, OpAssignable, int(sym.Scope), sym.Index)
+		if stat.Op == "=" {
+			c.emit(OpPop)
+		}
+		if stat.Op != "=" {
+			if err := c.compileBinary(stat, op, stat.Value); err != nil {
+				return err
+			}
+		} else if err := c.compileExpression(stat.Value); err != nil {
+			return err
+		}
+		if value {
+			c.emit(OpDup)
+		}
+		c.store(sym)
+		return nil
+	case *ast.IndexExpression:
+		if err := c.compileExpression(target.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(target.Index); err != nil {
+			return err
+		}
+		c.emitNode(stat, OpIndexCurrent)
+		if stat.Op == "=" {
+			c.emit(OpPop)
+		}
+		if stat.Op != "=" {
+			if err := c.compileBinary(stat, op, stat.Value); err != nil {
+				return err
+			}
+		} else if err := c.compileExpression(stat.Value); err != nil {
+			return err
+		}
+		c.emit(OpSetIndex)
+		if !value {
+			c.emit(OpPop)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%v: cannot assign to %v", stat.Pos(), stat.Target)
+	}
+}
+
+func (c *Compiler) compileWhileStatement(stat *ast.WhileStatement, value bool) error {
+	start := len(c.scope.fn.Instructions)
+	if err := c.compileExpression(stat.Condition); err != nil {
+		return err
+	}
+	exit := c.emitNode(stat, OpJumpIfFalse, 0)
+	l, err := c.compileLoopBody(stat.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(OpJump, start)
+	c.patchJump(exit)
+	c.patchJumps(l.breaks)
+	c.patchJumpsTo(l.continues, start)
+	if value {
+		c.emit(OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) compileForStatement(stat *ast.ForStatement, value bool) error {
+	if stat.Init != nil {
+		if err := c.compileStatement(stat.Init, false); err != nil {
+			return err
+		}
+	}
+	start := len(c.scope.fn.Instructions)
+	exit := -1
+	if stat.Condition != nil {
+		if err := c.compileExpression(stat.Condition); err != nil {
+			return err
+		}
+		exit = c.emitNode(stat, OpJumpIfFalse, 0)
+	}
+	l, err := c.compileLoopBody(stat.Body)
+	if err != nil {
+		return err
+	}
+	c.patchJumps(l.continues)
+	if stat.Post != nil {
+		if err := c.compileStatement(stat.Post, false); err != nil {
+			return err
+		}
+	}
+	c.emit(OpJump, start)
+	if exit >= 0 {
+		c.patchJump(exit)
+	}
+	c.patchJumps(l.breaks)
+	if value {
+		c.emit(OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) compileForInStatement(stat *ast.ForInStatement, value bool) error {
+	if err := c.compileExpression(stat.Iterable); err != nil {
+		return err
+	}
+	c.emitNode(stat, OpIter)
+	next := c.emit(OpIterNext, 0)
+	c.store(c.symbol(stat.Variable))
+	l, err := c.compileLoopBody(stat.Body)
+	if err != nil {
+		return err
+	}
+	c.patchJumpsTo(l.continues, next)
+	c.emit(OpJump, next)
+	// A break statement leaves the iterator on the stack.
+	c.patchJumps(l.breaks)
+	c.emit(OpPop)
+	c.patchJump(next)
+	if value {
+		c.emit(OpNull)
+	}
+	return nil
+}
+
+// compileLoopBody compiles the body of a loop, which leaves nothing on the
+// stack, and returns the jumps of its break and continue statements.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement) (*loop, error) {
+	l := &loop{depth: c.scope.depth}
+	c.scope.loops = append(c.scope.loops, l)
+	c.emitNode(body, OpCheck)
+	for _, stat := range body.Statements {
+		if err := c.compileStatement(stat, false); err != nil {
+			return nil, err
+		}
+	}
+	c.scope.loops = c.scope.loops[:len(c.scope.loops)-1]
+	return l, nil
+}
+
+// compileBranch compiles a break or continue statement into a jump out of
+// the innermost loop, after popping the values pushed in its body.
+func (c *Compiler) compileBranch(stat ast.Statement, isContinue bool) error {
+	if len(c.scope.loops) == 0 {
+		return fmt.Errorf("%v: %v outside loop", stat.Pos(), stat)
+	}
+	l := c.scope.loops[len(c.scope.loops)-1]
+	depth := c.scope.depth
+	if n := depth - l.depth; n > 0 {
+		c.emit(OpPopN, n)
+	}
+	jump := c.emit(OpJump, 0)
+	if isContinue {
+		l.continues = append(l.continues, jump)
+	} else {
+		l.breaks = append(l.breaks, jump)
+	}
+	// The code that follows is unreachable, but compiled at the depth
+	// before the statement.
+	c.setDepth(depth)
+	return nil
+}
+
+// compileExpression compiles expr into code that pushes its value.
+func (c *Compiler) compileExpression(expr ast.Expression) error {
+	switch expr := expr.(type) {
+	case *ast.Integer:
+		c.emit(OpConstant, c.addConstant(&object.Integer{Value: expr.Value}))
+	case *ast.Float:
+		c.emit(OpConstant, c.addConstant(&object.Float{Value: expr.Value}))
+	case *ast.String:
+		// The node is kept to report strings longer than the limits.
+		c.emitNode(expr, OpConstant, c.addConstant(&object.String{Value: expr.Value}))
+	case *ast.Boolean:
+		if expr.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *ast.Identifier:
+		c.load(expr, c.symbol(expr))
+	case *ast.PrefixExpression:
+		var op Opcode
+		switch expr.Op {
+		case "-":
+			op = OpMinus
+		case "!":
+			op = OpBang
+		default:
+			return fmt.Errorf("%v: cannot compile operator %v", expr.Pos(), expr.Op)
+		}
+		if err := c.compileExpression(expr.Value); err != nil {
+			return err
+		}
+		c.emitNode(expr, op)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(expr)
+	case *ast.IfExpression:
+		return c.compileIfExpression(expr)
+	case *ast.Function:
+		return c.compileFunction(expr)
+	case *ast.CallExpression:
+		if err := c.compileExpression(expr.Function); err != nil {
+			return err
+		}
+		for _, arg := range expr.Arguments {
+			if err := c.compileExpression(arg); err != nil {
+				return err
+			}
+		}
+		op := OpCall
+		if expr.Tail {
+			op = OpTailCall
+		}
+		c.emitNode(expr, op, len(expr.Arguments))
+	case *ast.Array:
+		for _, e := range expr.Elements {
+			if err := c.compileExpression(e); err != nil {
+				return err
+			}
+		}
+		c.emitNode(expr, OpArray, len(expr.Elements))
+	case *ast.Hash:
+		for _, p := range expr.Pairs {
+			if err := c.compileExpression(p.Key); err != nil {
+				return err
+			}
+			c.emitNode(p.Key, OpHashKey)
+			if err := c.compileExpression(p.Value); err != nil {
+				return err
+			}
+		}
+		c.emitNode(expr, OpHash, len(expr.Pairs))
+	case *ast.IndexExpression:
+		if err := c.compileExpression(expr.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(expr.Index); err != nil {
+			return err
+		}
+		c.emitNode(expr, OpIndex)
+	default:
+		return fmt.Errorf("%v: cannot compile %T", expr.Pos(), expr)
+	}
+	return nil
+}
+
+func (c *Compiler) compileInfixExpression(expr *ast.InfixExpression) error {
+	// An operation on a local and an integer literal, like n - 1, is a
+	// single instruction.
+	if left, ok := expr.Left.(*ast.Identifier); ok && left.Local && left.Depth == 0 && !c.scope.captured[left.Slot] {
+		right, ok := expr.Right.(*ast.Integer)
+		if op, isOp := operatorIndex(expr.Op); ok && isOp {
+			c.emitNode(expr, OpLocalBinary, op, left.Slot, c.addConstant(&object.Integer{Value: right.Value}))
+			return nil
+		}
+	}
+	if err := c.compileExpression(expr.Left); err != nil {
+		return err
+	}
+	if expr.Op == "&&" || expr.Op == "||" {
+		op := OpAnd
+		if expr.Op == "||" {
+			op = OpOr
+		}
+		jump := c.emitNode(expr, op, 0)
+		if err := c.compileExpression(expr.Right); err != nil {
+			return err
+		}
+		c.emitNode(expr, OpCheckLogical)
+		c.patchJump(jump)
+		return nil
+	}
+	op, ok := operatorIndex(expr.Op)
+	if !ok {
+		return fmt.Errorf("%v: cannot compile operator %v", expr.Pos(), expr.Op)
+	}
+	return c.compileBinary(expr, op, expr.Right)
+}
+
+// compileBinary compiles the right operand of the binary operator op, whose
+// left operand is on the stack, and the operation compiled from node. An
+// integer literal is used as a constant by the operation.
+func (c *Compiler) compileBinary(node ast.Node, op int, right ast.Expression) error {
+	if i, ok := right.(*ast.Integer); ok {
+		c.emitNode(node, OpBinaryConst, op, c.addConstant(&object.Integer{Value: i.Value}))
+		return nil
+	}
+	if err := c.compileExpression(right); err != nil {
+		return err
+	}
+	c.emitNode(node, OpBinary, op)
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(expr *ast.IfExpression) error {
+	if err := c.compileExpression(expr.Condition); err != nil {
+		return err
+	}
+	alternative := c.emitNode(expr, OpJumpIfFalse, 0)
+	depth := c.scope.depth
+	if err := c.compileStatements(expr.Consequence.Statements); err != nil {
+		return err
+	}
+	end := c.emit(OpJump, 0)
+	c.patchJump(alternative)
+	c.setDepth(depth)
+	if expr.Alternative == nil {
+		c.emit(OpNull)
+	} else if err := c.compileStatements(expr.Alternative.Statements); err != nil {
+		return err
+	}
+	c.patchJump(end)
+	return nil
+}
+
+func (c *Compiler) compileFunction(expr *ast.Function) error {
+	scope := &compilation{
+		fn: &CompiledFunction{
+			Name:       expr.Name,
+			Parameters: expr.Parameters,
+			Body:       expr.Body,
+			NumLocals:  expr.NumSlots,
+			Nodes:      make(map[int]ast.Node),
+		},
+		captured: capturedSlots(expr),
+		outer:    c.scope,
+	}
+	for slot := 0; slot < expr.NumSlots; slot++ {
+		if scope.captured[slot] {
+			scope.fn.Cells = append(scope.fn.Cells, slot)
+		}
+	}
+	c.scope = scope
+
+	if err := c.compileStatements(expr.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(OpReturnValue)
+	if c.err != nil {
+		return c.err
+	}
+	if len(c.scope.fn.Instructions) > math.MaxUint16 {
+		return fmt.Errorf("%v: function too large to compile", expr.Pos())
+	}
+	fn := c.finishScope()
+
+	// The closure captures the cells of the variables of this function, and
+	// those of enclosing functions captured by this function in turn.
+	for _, v := range scope.free {
+		if v.depth == 1 {
+			c.emit(OpLoadCell, v.slot)
+		} else {
+			c.emit(OpLoadFree, c.freeIndex(v.depth-1, v.slot))
+		}
+	}
+	c.emit(OpClosure, c.addConstant(fn), len(scope.free))
+	return nil
+}
+
+// symbol returns where the variable id is bound to is stored.
+func (c *Compiler) symbol(id *ast.Identifier) Symbol {
+	switch {
+	case !id.Local:
+		return Symbol{Scope: GlobalScope, Index: c.global(id.Value)}
+	case id.Depth > 0:
+		return Symbol{Scope: FreeScope, Index: c.freeIndex(id.Depth, id.Slot)}
+	case c.scope.captured[id.Slot]:
+		return Symbol{Scope: CellScope, Index: id.Slot}
+	default:
+		return Symbol{Scope: LocalScope, Index: id.Slot}
+	}
+}
+
+// global returns the index of the global name, defining it if it is new.
+func (c *Compiler) global(name string) int {
+	if i, ok := c.globalIndexes[name]; ok {
+		return i
+	}
+	c.globalIndexes[name] = len(c.globals)
+	c.globals = append(c.globals, name)
+	return len(c.globals) - 1
+}
+
+// freeIndex returns the index of the free variable of the current function
+// for the slot of the function depth levels out, adding it if it is new.
+func (c *Compiler) freeIndex(depth, slot int) int {
+	v := freeVariable{depth: depth, slot: slot}
+	for i, f := range c.scope.free {
+		if f == v {
+			return i
+		}
+	}
+	c.scope.free = append(c.scope.free, v)
+	return len(c.scope.free) - 1
+}
+
+// load emits the instruction pushing the value of sym, referenced by node.
+func (c *Compiler) load(node ast.Node, sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emitNode(node, OpGetGlobal, sym.Index)
+	case LocalScope:
+		c.emitNode(node, OpGetLocal, sym.Index)
+	case CellScope:
+		c.emitNode(node, OpGetCell, sym.Index)
+	case FreeScope:
+		c.emitNode(node, OpGetFree, sym.Index)
+	}
+}
+
+// store emits the instruction popping a value into sym.
+func (c *Compiler) store(sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(OpSetGlobal, sym.Index)
+	case LocalScope:
+		c.emit(OpSetLocal, sym.Index)
+	case CellScope:
+		c.emit(OpSetCell, sym.Index)
+	case FreeScope:
+		c.emit(OpSetFree, sym.Index)
+	}
+}
+
+func (c *Compiler) addConstant(o object.Object) int {
+	c.constants = append(c.constants, o)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction to the current function and returns its
+// offset.
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	return c.emitNode(nil, op, operands...)
+}
+
+// emitNode is like emit for an instruction compiled from node, if node is
+// not nil. An operand too large for its width is reported by Compile, at
+// node or else at the function being compiled.
+func (c *Compiler) emitNode(node ast.Node, op Opcode, operands ...int) int {
+	fn := c.scope.fn
+	pos := len(fn.Instructions)
+	ins := Make(op, operands...)
+	if ins == nil {
+		c.operandError(node, op, operands)
+		ins = Make(op)
+	}
+	fn.Instructions = append(fn.Instructions, ins...)
+	if node != nil {
+		fn.Nodes[pos] = node
+	}
+	c.setDepth(c.scope.depth + stackEffect(op, operands))
+	return pos
+}
+
+func (c *Compiler) operandError(node ast.Node, op Opcode, operands []int) {
+	if c.err != nil {
+		return
+	}
+	err := checkOperands(definitions[op], operands)
+	if node == nil && c.scope.fn.Body != nil {
+		node = c.scope.fn.Body
+	}
+	if node == nil {
+		c.err = fmt.Errorf("program too large to compile: %v", err)
+		return
+	}
+	c.err = fmt.Errorf("%v: too large to compile: %v", node.Pos(), err)
+}
+
+func (c *Compiler) setDepth(depth int) {
+	c.scope.depth = depth
+	if depth > c.scope.fn.MaxStack {
+		c.scope.fn.MaxStack = depth
+	}
+}
+
+// stackEffect returns the change of the stack depth caused by an
+// instruction, when it does not jump.
+func stackEffect(op Opcode, operands []int) int {
+	switch op {
+	case OpConstant, OpNull, OpTrue, OpFalse, OpDup,
+		OpGetGlobal, OpGetLocal, OpGetCell, OpGetFree, OpLoadCell, OpLoadFree,
+		OpAssignable, OpIndexCurrent, OpIterNext, OpLocalBinary:
+		return 1
+	case OpPop, OpBinary, OpAnd, OpOr, OpJumpIfFalse, OpIndex,
+		OpSetGlobal, OpSetLocal, OpSetCell, OpSetFree:
+		return -1
+	case OpPopN:
+		return -operands[0]
+	case OpSetIndex:
+		return -2
+	case OpClosure:
+		return 1 - operands[1]
+	case OpCall, OpTailCall:
+		return -operands[0]
+	case OpArray:
+		return 1 - operands[0]
+	case OpHash:
+		return 1 - 2*operands[0]
+	default:
+		// OpReturnValue leaves the function, and is compiled as if it had a
+		// value like any statement.
+		return 0
+	}
+}
+
+// patchJump sets the target of the jump at pos to the current offset.
+func (c *Compiler) patchJump(pos int) {
+	c.patchJumpsTo([]int{pos}, len(c.scope.fn.Instructions))
+}
+
+func (c *Compiler) patchJumps(jumps []int) {
+	c.patchJumpsTo(jumps, len(c.scope.fn.Instructions))
+}
+
+func (c *Compiler) patchJumpsTo(jumps []int, target int) {
+	ins := c.scope.fn.Instructions
+	for _, pos := range jumps {
+		copy(ins[pos:], Make(Opcode(ins[pos]), target))
+	}
+}
@@ -0,0 +1,176 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/parser"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		want     []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpPop, nil, []byte{byte(OpPop)}},
+		{OpClosure, []int{1, 2}, []byte{byte(OpClosure), 0, 1, 0, 2}},
+		// Operands that do not fit in their widths.
+		{OpConstant, []int{65536}, nil},
+		{OpClosure, []int{1, -1}, nil},
+	}
+	for _, test := range tests {
+		ins := Make(test.op, test.operands...)
+		if string(ins) != string(test.want) || (ins == nil) != (test.want == nil) {
+			t.Errorf("Make(%v, %v) = %v; want %v", test.op, test.operands, ins, test.want)
+		}
+		if ins == nil {
+			continue
+		}
+		def, err := Lookup(test.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		operands, n := ReadOperands(def, ins[1:])
+		if n != len(ins)-1 {
+			t.Errorf("ReadOperands read %v bytes; want %v", n, len(ins)-1)
+		}
+		for i, o := range operands {
+			if o != test.operands[i] {
+				t.Errorf("got operand %v; want %v", o, test.operands[i])
+			}
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{
+			`2 + x`,
+			"0000 OpConstant 0\n" +
+				"0003 OpGetGlobal 0\n" +
+				"0006 OpBinary 0\n" +
+				"0009 OpReturnValue\n",
+		},
+		{
+			`1 + 2`,
+			"0000 OpConstant 0\n" +
+				"0003 OpBinaryConst 0 1\n" +
+				"0008 OpReturnValue\n",
+		},
+		{
+			`var x = true; x`,
+			"0000 OpTrue\n" +
+				"0001 OpSetGlobal 0\n" +
+				"0004 OpGetGlobal 0\n" +
+				"0007 OpReturnValue\n",
+		},
+		{
+			`while (x) { break }`,
+			"0000 OpGetGlobal 0\n" +
+				"0003 OpJumpIfFalse 13\n" +
+				"0006 OpCheck\n" +
+				"0007 OpJump 13\n" +
+				"0010 OpJump 0\n" +
+				"0013 OpNull\n" +
+				"0014 OpReturnValue\n",
+		},
+	}
+	for _, test := range tests {
+		program, err := parser.New(lexer.New(test.code)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bytecode, err := Compile(program)
+		if err != nil {
+			t.Fatalf("%q: %v", test.code, err)
+		}
+		if got := bytecode.Main.Instructions.String(); got != test.want {
+			t.Errorf("%q: got\n%v\nwant\n%v", test.code, got, test.want)
+		}
+	}
+}
+
+func TestCompileClosure(t *testing.T) {
+	program, err := parser.New(lexer.New(`func(a) { var b = 1; func() { a + b + c } }`)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer := bytecode.Constants[len(bytecode.Constants)-1].(*CompiledFunction)
+	if outer.NumLocals != 2 || len(outer.Cells) != 2 {
+		t.Errorf("got %v locals and cells %v; want 2 locals in cells", outer.NumLocals, outer.Cells)
+	}
+	if len(bytecode.Globals) != 1 || bytecode.Globals[0] != "c" {
+		t.Errorf("got globals %v; want [c]", bytecode.Globals)
+	}
+}
+
+// TestCompileFreeVariables checks that a closure captures the cells of the
+// variables of enclosing functions through the functions in between.
+func TestCompileFreeVariables(t *testing.T) {
+	program, err := parser.New(lexer.New(`func(a, b) { func() { b; func() { a + b } } }`)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The functions are added to the constants innermost first.
+	var functions []*CompiledFunction
+	for _, o := range bytecode.Constants {
+		if fn, ok := o.(*CompiledFunction); ok {
+			functions = append(functions, fn)
+		}
+	}
+	if len(functions) != 3 {
+		t.Fatalf("got %v functions; want 3", len(functions))
+	}
+	inner, middle, outer := functions[0], functions[1], functions[2]
+	if len(outer.Cells) != 2 {
+		t.Errorf("got cells %v; want [0 1]", outer.Cells)
+	}
+	tests := []struct {
+		fn   *CompiledFunction
+		want string
+	}{
+		{inner, "0000 OpGetFree 0\n0003 OpGetFree 1\n0006 OpBinary 0\n0009 OpReturnValue\n"},
+		{middle, "0000 OpGetFree 0\n0003 OpPop\n0004 OpLoadFree 1\n0007 OpLoadFree 0\n0010 OpClosure 0 2\n0015 OpReturnValue\n"},
+		{outer, "0000 OpLoadCell 1\n0003 OpLoadCell 0\n0006 OpClosure 1 2\n0011 OpReturnValue\n"},
+	}
+	for i, test := range tests {
+		if got := test.fn.Instructions.String(); got != test.want {
+			t.Errorf("function %v: got\n%v\nwant\n%v", i, got, test.want)
+		}
+	}
+}
+
+func TestCompileTooLarge(t *testing.T) {
+	many := "true" + strings.Repeat(", true", 1<<16-1)
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"[" + many + "]", "1:1: too large to compile: operand 65536 of OpArray exceeds 65535"},
+		{"f(" + many + ")", "1:1: too large to compile: operand 65536 of OpCall exceeds 65535"},
+		{"var g = func() { [" + many + "] }", "1:18: too large to compile: operand 65536 of OpArray exceeds 65535"},
+	}
+	for _, test := range tests {
+		program, err := parser.New(lexer.New(test.code)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Compile(program); err == nil || err.Error() != test.want {
+			t.Errorf("%.20q...: got error %v; want %v", test.code, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package compiler
+
+import (
+	"github.com/wangkekekexili/mankey/ast"
+)
+
+// Scope tells where the value of a variable is stored.
+type Scope int
+
+const (
+	GlobalScope Scope = iota // a global of the program
+	LocalScope               // a local of the function being executed
+	CellScope                // a local captured by a closure, stored in a cell
+	FreeScope                // a variable of an enclosing function captured by a closure
+)
+
+// Symbol tells where the variable an identifier is bound to is stored.
+type Symbol struct {
+	Scope Scope
+	Index int
+}
+
+// freeVariable is a variable of an enclosing function captured by a
+// closure: the slot of the function depth levels out, as bound by the
+// resolver.
+type freeVariable struct {
+	depth, slot int
+}
+
+// capturedSlots returns the slots of fn used by the functions nested in it.
+func capturedSlots(fn *ast.Function) map[int]bool {
+	captured := make(map[int]bool)
+	var inspect func(body *ast.BlockStatement, depth int)
+	inspect = func(body *ast.BlockStatement, depth int) {
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Function:
+				inspect(n.Body, depth+1)
+				return false
+			case *ast.Identifier:
+				if n.Local && depth > 0 && n.Depth == depth {
+					captured[n.Slot] = true
+				}
+			}
+			return true
+		})
+	}
+	inspect(fn.Body, 0)
+	return captured
+}
@@ -1,33 +1,42 @@
 package evaluator
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
 	"github.com/wangkekekexili/mankey/object"
 )
 
 var builtins = map[string]*object.Builtin{
 	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				panic("len accept one argument")
+		Name: "len",
+		Fn: func(args ...object.Object) (object.Object, error) {
+			if err := object.CheckArgs(args, 1, 1); err != nil {
+				return nil, err
 			}
 			switch e := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(e.Value))}
+				return &object.Integer{Value: int64(len(e.Value))}, nil
 			case *object.Array:
-				return &object.Integer{Value: int64(len(e.Elements))}
+				return &object.Integer{Value: int64(len(e.Elements))}, nil
 			default:
-				panic("unexpected object for len")
+				return nil, fmt.Errorf("argument 1 must be %v or %v; got %v", object.ObjString, object.ObjArray, e.Type())
 			}
 		},
 	},
 	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) <= 1 {
-				panic("push accepts at least 2 arguments")
+		Name: "push",
+		Fn: func(args ...object.Object) (object.Object, error) {
+			if err := object.CheckArgs(args, 2, -1); err != nil {
+				return nil, err
 			}
 			arr, ok := args[0].(*object.Array)
 			if !ok {
-				panic("the first argument for push must be an array")
+				return nil, object.ArgTypeError(0, object.ObjArray, args[0])
 			}
 			newArr := &object.Array{
 				Elements: make([]object.Object, 0, len(arr.Elements)+len(args)-1),
@@ -36,7 +45,95 @@ var builtins = map[string]*object.Builtin{
 				newArr.Elements = append(newArr.Elements, e)
 			}
 			newArr.Elements = append(newArr.Elements, args[1:]...)
-			return newArr
+			return newArr, nil
 		},
 	},
+	"int": {
+		Name: "int",
+		Fn: func(args ...object.Object) (object.Object, error) {
+			if err := object.CheckArgs(args, 1, 1); err != nil {
+				return nil, err
+			}
+			switch e := args[0].(type) {
+			case *object.Integer:
+				return e, nil
+			case *object.Float:
+				if math.IsNaN(e.Value) || e.Value < math.MinInt64 || e.Value >= math.MaxInt64 {
+					return nil, fmt.Errorf("cannot convert %v to integer", e)
+				}
+				return &object.Integer{Value: int64(e.Value)}, nil
+			case *object.String:
+				v, err := strconv.ParseInt(e.Value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot convert %q to integer", e.Value)
+				}
+				return &object.Integer{Value: v}, nil
+			default:
+				return nil, fmt.Errorf("cannot convert %v to integer", e.Type())
+			}
+		},
+	},
+	"float": {
+		Name: "float",
+		Fn: func(args ...object.Object) (object.Object, error) {
+			if err := object.CheckArgs(args, 1, 1); err != nil {
+				return nil, err
+			}
+			switch e := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: float64(e.Value)}, nil
+			case *object.Float:
+				return e, nil
+			case *object.String:
+				v, err := strconv.ParseFloat(e.Value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot convert %q to float", e.Value)
+				}
+				return &object.Float{Value: v}, nil
+			default:
+				return nil, fmt.Errorf("cannot convert %v to float", e.Type())
+			}
+		},
+	},
+	"puts": {
+		Name: "puts",
+		ContextFn: func(ctx context.Context, args ...object.Object) (object.Object, error) {
+			w := Stdout(ctx)
+			for _, arg := range args {
+				fmt.Fprintln(w, arg)
+			}
+			return object.Null, nil
+		},
+	},
+}
+
+type stdoutKey struct{}
+
+// WithStdout returns a copy of ctx in which the builtin puts writes to w.
+func WithStdout(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, stdoutKey{}, w)
+}
+
+// Stdout returns the writer of the builtin puts in ctx, which is os.Stdout
+// unless set with WithStdout.
+func Stdout(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(stdoutKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
+// callBuiltin calls b with args in ctx. A panic in b is recovered and
+// returned as an error, so that a faulty builtin cannot crash the host
+// program.
+func callBuiltin(ctx context.Context, b *object.Builtin, args []object.Object) (o object.Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			o, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if b.ContextFn != nil {
+		return b.ContextFn(ctx, args...)
+	}
+	return b.Fn(args...)
 }
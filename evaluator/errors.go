@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/token"
+)
+
+// Frame is a function call that was in progress when a runtime error
+// occurred.
+type Frame struct {
+	Function string         // name of the called function, or "<anonymous>"
+	Pos      token.Position // position of the call expression
+}
+
+// RuntimeError is an error that occurred while evaluating a program.
+type RuntimeError struct {
+	Node   ast.Node // the node whose evaluation failed; may be nil
+	Pos    token.Position
+	Msg    string
+	Frames []Frame // the innermost call comes first
+	Err    error   // the underlying cause, such as a context error, if any
+}
+
+// Error returns the message prefixed with the source position, without the
+// call stack.
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// Unwrap returns the underlying cause of the error, if any.
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// tracebackFrames is the number of outermost and of innermost frames shown
+// by Traceback when the stack is deep.
+const tracebackFrames = 10
+
+// Traceback returns the call stack leading to the error, outermost call
+// first, followed by the error itself. The middle of a deep stack is elided.
+func (e *RuntimeError) Traceback() string {
+	var b strings.Builder
+	if len(e.Frames) != 0 {
+		b.WriteString("Traceback (most recent call last):\n")
+		for i := len(e.Frames) - 1; i >= 0; i-- {
+			if len(e.Frames) > 2*tracebackFrames && i == len(e.Frames)-1-tracebackFrames {
+				omitted := len(e.Frames) - 2*tracebackFrames
+				fmt.Fprintf(&b, "  ... %v more calls ...\n", omitted)
+				i -= omitted - 1
+				continue
+			}
+			fmt.Fprintf(&b, "  %v: call to %v\n", e.Frames[i].Pos, e.Frames[i].Function)
+		}
+	}
+	b.WriteString(e.Error())
+	return b.String()
+}
+
+// Traceback returns the traceback of err if it is a *RuntimeError, or else
+// its message.
+func Traceback(err error) string {
+	if e, ok := err.(*RuntimeError); ok {
+		return e.Traceback()
+	}
+	return err.Error()
+}
+
+// errorf returns a RuntimeError at the source position of node.
+func errorf(node ast.Node, format string, a ...interface{}) error {
+	return &RuntimeError{
+		Node: node,
+		Pos:  node.Pos(),
+		Msg:  fmt.Sprintf(format, a...),
+	}
+}
+
+// addFrame records that err occurred in a call of the function named name at
+// call.
+func addFrame(err error, name string, call *ast.CallExpression) error {
+	if e, ok := err.(*RuntimeError); ok {
+		e.Frames = append(e.Frames, Frame{Function: name, Pos: call.Pos()})
+	}
+	return err
+}
+
+// NewCanceledError returns a RuntimeError at node reporting that the
+// evaluation was stopped because its context is done with err.
+func NewCanceledError(node ast.Node, err error) error {
+	return &RuntimeError{
+		Node: node,
+		Pos:  node.Pos(),
+		Msg:  fmt.Sprintf("evaluation canceled: %v", err),
+		Err:  err,
+	}
+}
+
+// IsCanceled reports whether err is a RuntimeError caused by the
+// cancellation or the deadline of the context passed to EvalContext.
+func IsCanceled(err error) bool {
+	e, ok := err.(*RuntimeError)
+	return ok && (e.Err == context.Canceled || e.Err == context.DeadlineExceeded)
+}
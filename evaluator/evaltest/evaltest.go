@@ -0,0 +1,397 @@
+// Package evaltest holds programs with their expected results. They are the
+// tests of package evaluator, shared with package vm so that the virtual
+// machine is checked against every one of them.
+package evaltest
+
+import (
+	"fmt"
+
+	"github.com/wangkekekexili/mankey/object"
+)
+
+// Test is a program to evaluate in a new environment with the default
+// limits, after checking it for undefined variables.
+type Test struct {
+	Code string
+	Want object.Object // the expected value, unless Err is set
+	Err  string        // the expected error
+}
+
+// Check returns an error if the value o or the error err of the program are
+// not the expected ones. Values are compared by type and string.
+func (test Test) Check(o object.Object, err error) error {
+	if test.Err != "" {
+		if err == nil {
+			return fmt.Errorf("%q: got %v; want error %q", test.Code, o, test.Err)
+		}
+		if err.Error() != test.Err {
+			return fmt.Errorf("%q: got error %q; want %q", test.Code, err, test.Err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%q: %v", test.Code, err)
+	}
+	if o.Type() != test.Want.Type() || o.String() != test.Want.String() {
+		return fmt.Errorf("%q: got %v %v; want %v %v", test.Code, o.Type(), o, test.Want.Type(), test.Want)
+	}
+	return nil
+}
+
+func integer(v int64) object.Object {
+	return &object.Integer{Value: v}
+}
+
+func float(v float64) object.Object {
+	return &object.Float{Value: v}
+}
+
+func boolean(v bool) object.Object {
+	if v {
+		return object.True
+	}
+	return object.False
+}
+
+func str(v string) object.Object {
+	return &object.String{Value: v}
+}
+
+func array(elements ...object.Object) object.Object {
+	return &object.Array{Elements: elements}
+}
+
+// hash returns a hash of the keys and values in kv, in turn.
+func hash(kv ...object.Object) object.Object {
+	h := object.NewHash()
+	for i := 0; i < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+// All returns the tests of every group below.
+func All() []Test {
+	var all []Test
+	for _, group := range [][]Test{
+		Integers, Floats, FloatComparisons, BuiltinInt, Booleans, Strings,
+		IfElse, Returns, Vars, Calls, Errors, ErrorPositions,
+		UndefinedVariables, BuiltinLen, Index, Hashes, Assignments,
+		AssignErrors, Loops, LoopErrors, BuiltinErrors, TailCalls,
+	} {
+		all = append(all, group...)
+	}
+	return all
+}
+
+var Integers = []Test{
+	{Code: "5", Want: integer(5)},
+	{Code: "-5", Want: integer(-5)},
+	{Code: "--5", Want: integer(5)},
+	{Code: "---5", Want: integer(-5)},
+	{Code: "42", Want: integer(42)},
+	{Code: "5 + 5 + 5 + 5 - 10", Want: integer(10)},
+	{Code: "2 * 2 * 2 * 2 * 2", Want: integer(32)},
+	{Code: "-50 + 100 + -50", Want: integer(0)},
+	{Code: "5 * 2 + 10", Want: integer(20)},
+	{Code: "5 + 2 * 10", Want: integer(25)},
+	{Code: "20 + 2 * -10", Want: integer(0)},
+	{Code: "50 / 2 * 2 + 10", Want: integer(60)},
+	{Code: "2 * (5 + 10)", Want: integer(30)},
+	{Code: "3 * 3 * 3 + 10", Want: integer(37)},
+	{Code: "3 * (3 * 3) + 10", Want: integer(37)},
+	{Code: "(5 + 10 * 2 + 15 / 3) * 2 + -10", Want: integer(50)},
+}
+
+var Floats = []Test{
+	{Code: "3.5", Want: float(3.5)},
+	{Code: "-2.5", Want: float(-2.5)},
+	{Code: "1e3", Want: float(1000)},
+	{Code: "0.5 + 0.25", Want: float(0.75)},
+	{Code: "1.5 * 2", Want: float(3)},
+	{Code: "2 * 1.5", Want: float(3)},
+	{Code: "7 / 2.0", Want: float(3.5)},
+	{Code: "10 - 0.5", Want: float(9.5)},
+	{Code: "float(3)", Want: float(3)},
+	{Code: `float("2.25")`, Want: float(2.25)},
+	{Code: "float(1.5)", Want: float(1.5)},
+}
+
+var FloatComparisons = []Test{
+	{Code: "1.5 < 2", Want: boolean(true)},
+	{Code: "2 <= 1.5", Want: boolean(false)},
+	{Code: "1 == 1.0", Want: boolean(true)},
+	{Code: "0.1 + 0.2 != 0.3", Want: boolean(true)},
+	{Code: "2.5 >= 2.5", Want: boolean(true)},
+}
+
+var BuiltinInt = []Test{
+	{Code: "int(3.99)", Want: integer(3)},
+	{Code: "int(-3.99)", Want: integer(-3)},
+	{Code: "int(42)", Want: integer(42)},
+	{Code: `int("-17")`, Want: integer(-17)},
+}
+
+var Booleans = []Test{
+	{Code: "true", Want: boolean(true)},
+	{Code: "false", Want: boolean(false)},
+	{Code: "!false", Want: boolean(true)},
+	{Code: "!!false", Want: boolean(false)},
+	{Code: "!true", Want: boolean(false)},
+	{Code: "!!true", Want: boolean(true)},
+	{Code: "1 < 2", Want: boolean(true)},
+	{Code: "1 > 2", Want: boolean(false)},
+	{Code: "1 < 1", Want: boolean(false)},
+	{Code: "1 > 1", Want: boolean(false)},
+	{Code: "1 == 1", Want: boolean(true)},
+	{Code: "1 != 1", Want: boolean(false)},
+	{Code: "1 == 2", Want: boolean(false)},
+	{Code: "1 != 2", Want: boolean(true)},
+	{Code: "true == true", Want: boolean(true)},
+	{Code: "false == false", Want: boolean(true)},
+	{Code: "true == false", Want: boolean(false)},
+	{Code: "true != false", Want: boolean(true)},
+	{Code: "false != true", Want: boolean(true)},
+	{Code: "(1 < 2) == true", Want: boolean(true)},
+	{Code: "(1 < 2) == false", Want: boolean(false)},
+	{Code: "(1 > 2) == true", Want: boolean(false)},
+	{Code: "(1 > 2) == false", Want: boolean(true)},
+	{Code: "true && true", Want: boolean(true)},
+	{Code: "true && false", Want: boolean(false)},
+	{Code: "false || true", Want: boolean(true)},
+	{Code: "false || false", Want: boolean(false)},
+	{Code: "1 < 2 && 2 < 3", Want: boolean(true)},
+	{Code: "1 > 2 || 2 > 3", Want: boolean(false)},
+	// The right operand is not evaluated if the left one decides.
+	{Code: "false && 1 / 0 == 0", Want: boolean(false)},
+	{Code: "true || 1 / 0 == 0", Want: boolean(true)},
+}
+
+var Strings = []Test{
+	{Code: `"hello"`, Want: str("hello")},
+	{Code: `"hello" + " " + "world"`, Want: str("hello world")},
+	{Code: `"line\n" + "\ttab \"quoted\""`, Want: str("line\n\ttab \"quoted\"")},
+	{Code: "`{\"raw\": \"\\n\"}`", Want: str(`{"raw": "\n"}`)},
+}
+
+var IfElse = []Test{
+	{Code: "if (true) { 10 }", Want: integer(10)},
+	{Code: "if (false) { 10; }", Want: object.Null},
+	{Code: "if (1 < 2) { 10; }", Want: integer(10)},
+	{Code: "if (1 > 2) { 10 }", Want: object.Null},
+	{Code: "if (1 > 2) { true } else { false }", Want: boolean(false)},
+	{Code: "if (1 < 2) { true } else { false }", Want: boolean(true)},
+}
+
+var Returns = []Test{
+	{Code: "return 10;", Want: integer(10)},
+	{Code: "return 10; 9;", Want: integer(10)},
+	{Code: "return 2 * 5; 9;", Want: integer(10)},
+	{Code: "9; return 2 * 5; 9;", Want: integer(10)},
+	{Code: `
+if (true) {
+  if (true) {
+    return 42;
+  }
+}
+return 10;
+`, Want: integer(42)},
+}
+
+var Vars = []Test{
+	{Code: "var n = 42;", Want: integer(42)},
+	{Code: "var n = 42; n+1", Want: integer(43)},
+	{Code: "var n = 42; var m = n - 2; m", Want: integer(40)},
+}
+
+var Calls = []Test{
+	{Code: "var fn = func(x) {return x;};fn(42)", Want: integer(42)},
+	{Code: "var double = func(x) { x * 2; }; double(5);", Want: integer(10)},
+	{Code: "var add = func(x, y) { x + y; }; add(5 + 5, add(5, 5));", Want: integer(20)},
+	{Code: "func(x) { x * 2 }(21)", Want: integer(42)},
+	{Code: "var add = func(x) { func(y) { x + y } }; add(1)(2)", Want: integer(3)},
+	{Code: "var fns = [func(x) { x + 1 }]; fns[0](41)", Want: integer(42)},
+	{Code: `var h = {"f": func(x) { -x }}; h["f"](42)`, Want: integer(-42)},
+}
+
+var Errors = []Test{
+	{Code: "!10", Err: "1:1: '!' only works on boolean value"},
+	{Code: "-true", Err: "1:1: '-' only works on number value"},
+	{Code: "1.5 / 0", Err: "1:1: divide by zero"},
+	{Code: "1 && true", Err: "1:1: '&&' only works on boolean values; got 1"},
+	{Code: "true && 1", Err: "1:9: '&&' only works on boolean values; got 1"},
+	{Code: `false || "a"`, Err: "1:10: '||' only works on boolean values; got a"},
+	{Code: `-"a"`, Err: "1:1: '-' only works on number value"},
+	{Code: "true + false", Err: "1:1: unexpected operator + for boolean operands"},
+	{Code: "if (1) {1}", Err: "1:5: non-boolean value for the if expression"},
+	{Code: "foobar", Err: "1:1: undefined identifier foobar"},
+}
+
+var ErrorPositions = []Test{
+	{Code: "1;\n  foobar", Err: "2:3: undefined identifier foobar"},
+	{Code: "var a = 1;\na + true", Err: "2:1: unsupported operator + for operands 1 and true"},
+	{Code: "10 / (5 - 5)", Err: "1:1: divide by zero"},
+	{Code: "[1, 2][\n5]", Err: "2:1: index 5 out of bound"},
+}
+
+var UndefinedVariables = []Test{
+	// Undefined variables are reported before the evaluation, even in code
+	// that would not run.
+	{Code: "if (false) { typo }", Err: "1:14: undefined identifier typo"},
+	{Code: "var f = func() { x = 1 }", Err: "1:18: assignment to undeclared variable x"},
+	{Code: "puts(1); a + b", Err: "1:10: undefined identifier a\n1:14: undefined identifier b"},
+	{Code: "var f = func(x) { func() { x + y } }", Err: "1:32: undefined identifier y"},
+	// The locals of a function are declared in the whole function, but may
+	// only be used after their declaration, even if they shadow a global or
+	// a builtin.
+	{Code: "var f = func() { var g = x; var x = 1 }; f()", Err: "1:26: variable x used before its declaration"},
+	{Code: "var x = 1; var f = func() { var y = x; var x = 2; y }; f()", Err: "1:37: variable x used before its declaration"},
+	{Code: "var f = func() { var y = len; var len = 2; y }; f()", Err: "1:26: variable len used before its declaration"},
+	{Code: "var x = 1; var f = func() { var x = x }", Err: "1:37: variable x used before its declaration"},
+	{Code: "var f = func() { x = 1; var x = 2 }", Err: "1:18: variable x used before its declaration"},
+	{Code: "var f = func() { for (k in k) {} }", Err: "1:28: variable k used before its declaration"},
+	// A closure may use a local declared after it, but not be called before
+	// it is set.
+	{Code: "var f = func() { var g = func() { x }; var x = 1; g() }; f()", Want: integer(1)},
+	{Code: "var f = func() { var g = func() { len }; var y = g(); var len = 1; y }; f()", Err: "1:35: undefined identifier len"},
+	{Code: "var f = func(x) { var y = x; var x = 2; x + y }; f(1)", Want: integer(3)},
+	{Code: "var f = func() { var n = 0; for (i in [1, 2]) { n += i }; n + i }; f()", Want: integer(5)},
+
+	// Globals may be used in functions before they are declared.
+	{Code: "var f = func() { g() }; var g = func() { 1 }; f()", Want: integer(1)},
+	{Code: "var x = 1; var f = func() { var x = 2; x }; f() + x", Want: integer(3)},
+	{Code: "var f = func(x) { func() { x += 1; x } }; var g = f(1); g(); g()", Want: integer(3)},
+	{Code: "var n = 0; for (i in [1, 2, 3]) { n += i }; n + i", Want: integer(9)},
+	{Code: `var len = func(x) { 1 }; len("abc")`, Want: integer(1)},
+}
+
+var BuiltinLen = []Test{
+	{Code: `len("")`, Want: integer(0)},
+	{Code: `len("42")`, Want: integer(2)},
+	{Code: `len("hello world")`, Want: integer(11)},
+	{Code: `var a = "ke"; len(a)`, Want: integer(2)},
+}
+
+var Index = []Test{
+	{Code: "[1][0]", Want: integer(1)},
+	{Code: "[1,2][1]", Want: integer(2)},
+	{Code: "var ages = [15, 26, 17];ages[1]", Want: integer(26)},
+	{Code: "{true: 42}[true]", Want: integer(42)},
+	{Code: "{1: 10, 2: 100}[2]", Want: integer(100)},
+}
+
+var Hashes = []Test{
+	{Code: "{1:true, 2:false}", Want: hash(integer(1), boolean(true), integer(2), boolean(false))},
+	{Code: `{"b": 1, "a": 2, "c": 3}`, Want: hash(str("b"), integer(1), str("a"), integer(2), str("c"), integer(3))},
+	{Code: `{"b": 1, "a": 2, "b": 3}`, Want: hash(str("b"), integer(3), str("a"), integer(2))},
+	{Code: `var h = {2: 1}; h[1] = 2; h[2] = 3; h`, Want: hash(integer(2), integer(3), integer(1), integer(2))},
+	{Code: `var s = ""; for (k in {"z": 1, "y": 2, "x": 3}) { s += k }; s`, Want: str("zyx")},
+	{Code: `var log = []; var f = func(x) { log = push(log, x); x }; {f("k1"): f(1), f("k2"): f(2)}; log`, Want: array(str("k1"), integer(1), str("k2"), integer(2))},
+}
+
+var Assignments = []Test{
+	{Code: "var x = 1; x = 2; x", Want: integer(2)},
+	{Code: "var x = 1; x = x + 1", Want: integer(2)},
+	{Code: "var x = 10; x += 5; x", Want: integer(15)},
+	{Code: "var x = 10; x -= 5; x", Want: integer(5)},
+	{Code: "var x = 10; x *= 5; x", Want: integer(50)},
+	{Code: "var x = 10; x /= 5; x", Want: integer(2)},
+	{Code: "var x = 1; var f = func() { x = 42; }; f(); x", Want: integer(42)},
+	{Code: "var x = 1; var f = func(x) { x = 42; }; f(0); x", Want: integer(1)},
+	{Code: `
+var counter = func() {
+	var n = 0;
+	func() { n += 1; n }
+};
+var next = counter();
+next(); next(); next()`, Want: integer(3)},
+	{Code: "var arr = [1, 2, 3]; arr[1] = 20; arr[1]", Want: integer(20)},
+	{Code: "var arr = [1, 2, 3]; arr[2] *= 10; arr[2]", Want: integer(30)},
+	{Code: "var arr = [1, 2, 3]; var alias = arr; alias[0] = 7; arr[0]", Want: integer(7)},
+	{Code: `var h = {"a": 1}; h["a"] = 2; h["a"]`, Want: integer(2)},
+	{Code: `var h = {"a": 1}; h["b"] = 5; h["b"]`, Want: integer(5)},
+	{Code: `var h = {"a": 1}; h["a"] += 41; h["a"]`, Want: integer(42)},
+}
+
+var AssignErrors = []Test{
+	{Code: "x = 1", Err: "1:1: assignment to undeclared variable x"},
+	{Code: "var f = func() { y = 1 }; f()", Err: "1:18: assignment to undeclared variable y"},
+	{Code: "var x = 1; x += true", Err: "1:12: unsupported operator + for operands 1 and true"},
+	{Code: "var arr = [1]; arr[1] = 2", Err: "1:20: index 1 out of bound"},
+	{Code: `var h = {}; h["a"] += 1`, Err: "1:13: unsupported operator + for operands NULL and 1"},
+	{Code: `var s = "a"; s[0] = "b"`, Err: "1:14: index assignment on non array object *object.String"},
+}
+
+var Loops = []Test{
+	{Code: "var i = 0; while (i < 10) { i += 1; } i", Want: integer(10)},
+	{Code: "var i = 0; while (false) { i += 1; } i", Want: integer(0)},
+	{Code: "var sum = 0; for (var i = 1; i <= 100; i += 1) { sum += i; } sum", Want: integer(5050)},
+	{Code: "var sum = 0; for (var i = 0; ; i += 1) { if (i == 5) { break; } sum += i; } sum", Want: integer(10)},
+	{Code: "var sum = 0; for (var i = 0; i < 10; i += 1) { if (i < 8) { continue; } sum += i; } sum", Want: integer(17)},
+	{Code: "var sum = 0; for (x in [1, 2, 3]) { sum += x; } sum", Want: integer(6)},
+	{Code: `var n = 0; for (c in "héllo") { n += 1; } n`, Want: integer(5)},
+	{Code: `var sum = 0; var h = {1: "a", 2: "b", 3: "c"}; for (k in h) { sum += k; } sum`, Want: integer(6)},
+	{Code: "var arr = [1, 2]; var n = 0; for (x in arr) { arr = push(arr, x); n += 1; } n", Want: integer(2)},
+	{Code: `
+var find = func(arr, target) {
+	for (var i = 0; i < len(arr); i += 1) {
+		if (arr[i] == target) { return i; }
+	}
+	-1
+};
+find([5, 6, 7], 7)`, Want: integer(2)},
+	{Code: `
+var count = 0;
+for (var i = 0; i < 3; i += 1) {
+	var j = 0;
+	while (true) {
+		j += 1;
+		if (j > i) { break; }
+		count += 1;
+	}
+}
+count`, Want: integer(3)},
+	{Code: "var i = 0; while (i < 100000) { i += 1; } i", Want: integer(100000)},
+}
+
+var LoopErrors = []Test{
+	{Code: "while (1) {}", Err: "1:8: non-boolean value for the loop condition"},
+	{Code: "for (;1;) {}", Err: "1:7: non-boolean value for the loop condition"},
+	{Code: "for (x in 1) {}", Err: "1:11: cannot iterate over *object.Integer"},
+	{Code: "while (true) { undefined }", Err: "1:16: undefined identifier undefined"},
+}
+
+var BuiltinErrors = []Test{
+	{Code: "len(1)", Err: "1:1: len: argument 1 must be String or ARRAY; got INTEGER"},
+	{Code: `len("a", "b")`, Err: "1:1: len: expects 1 argument; got 2"},
+	{Code: "push([])", Err: "1:1: push: expects at least 2 arguments; got 1"},
+	{Code: "push(1, 2)", Err: "1:1: push: argument 1 must be ARRAY; got INTEGER"},
+	{Code: `int("x")`, Err: `1:1: int: cannot convert "x" to integer`},
+	{Code: "int(true)", Err: "1:1: int: cannot convert BOOLEAN to integer"},
+	{Code: "float([])", Err: "1:1: float: cannot convert ARRAY to float"},
+	{Code: "var f = func() { len(1) }; f()", Err: "1:18: len: argument 1 must be String or ARRAY; got INTEGER"},
+}
+
+var TailCalls = []Test{
+	{Code: "var count = func(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(100000)", Want: integer(0)},
+	{Code: "var count = func(n) { if (n == 0) { return 0; } return count(n - 1); }; count(100000)", Want: integer(0)},
+	{Code: "var sum = func(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", Want: integer(5000050000)},
+	{Code: `
+var loop = func(i, n) {
+	for (x in [0]) {
+		if (i == n) { return i; }
+		return loop(i + 1, n);
+	}
+};
+loop(0, 100000)`, Want: integer(100000)},
+	// Only calls in tail position are replaced.
+	{Code: "var fib = func(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", Want: integer(610)},
+	// A tail call of another function is an ordinary call.
+	{Code: `
+var isEven = func(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+var isOdd = func(n) { if (n == 0) { false } else { isEven(n - 1) } };
+if (isEven(1000)) { 1 } else { 0 }`, Want: integer(1)},
+	{Code: "var f = func(n) { var g = func(m) { if (m == 0) { n } else { g(m - 1) } }; g(n) }; f(50000)", Want: integer(50000)},
+	{Code: "var count = func(n) { if (n == 0) { 1 / 0 } else { count(n - 1) } }; count(100)", Err: "1:37: divide by zero"},
+	{Code: "var f = func(a) { f(a, a) }; f(1)", Err: "1:19: function expects 1 parameter; 2 provided"},
+}
@@ -1,62 +1,173 @@
 package evaluator
 
 import (
-	"errors"
+	"context"
 	"fmt"
 
 	"github.com/wangkekekexili/mankey/ast"
 	"github.com/wangkekekexili/mankey/object"
+	"github.com/wangkekekexili/mankey/resolver"
 )
 
+// Eval evaluates node in env.
 func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext evaluates node in env like Eval, but stops when ctx is done.
+// Cancellation is checked at every function call and loop iteration, and
+// reported as a RuntimeError for which IsCanceled returns true.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) (object.Object, error) {
+	return EvalLimits(ctx, node, env, DefaultLimits)
+}
+
+// EvalLimits evaluates node in env like EvalContext, and stops with a
+// RuntimeError caused by a *LimitError when the evaluation exceeds limits.
+//
+// Unless node is a program resolved already, as the parser returns, it is
+// resolved first; a program changed after it was resolved must be resolved
+// again with resolver.Resolve. Before evaluating node, references to globals
+// that are neither declared in node nor defined in env are reported as a
+// resolver.ErrorList. An Interpreter, whose later programs may define the
+// globals of earlier ones, does not report them until they are evaluated.
+func EvalLimits(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) (object.Object, error) {
+	resolve(node)
+	defined := func(name string) bool {
+		_, ok := env.Get(name)
+		if !ok {
+			_, ok = LookupBuiltin(name)
+		}
+		return ok
+	}
+	if err := resolver.Check(node, defined); err != nil {
+		return nil, err
+	}
+	return evaluate(ctx, node, env, limits)
+}
+
+// resolve resolves node unless it is a program resolved already.
+func resolve(node ast.Node) {
+	if p, ok := node.(*ast.Program); !ok || !p.Resolved {
+		resolver.Resolve(node)
+	}
+}
+
+// evaluate evaluates node like EvalLimits, without checking it first.
+func evaluate(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) (object.Object, error) {
+	s := &state{ctx: ctx, done: ctx.Done(), limits: limits}
+	return s.eval(node, env)
+}
+
+// state is the state of one evaluation.
+type state struct {
+	ctx  context.Context
+	done <-chan struct{}
+
+	limits Limits
+	steps  int64 // number of nodes evaluated
+	depth  int   // number of function calls in progress
+
+	function *object.Function // the function being called, if any
+	frame    *object.Frame    // the locals of the call, if any
+}
+
+const objTailCall = "TAIL_CALL"
+
+// tailCall is the result of a call of the current function by itself in tail
+// position, which callFunction turns into the next iteration of a loop.
+type tailCall struct {
+	args []object.Object
+}
+
+func (t *tailCall) Type() object.ObjectType {
+	return objTailCall
+}
+
+func (t *tailCall) String() string {
+	return objTailCall
+}
+
+// check returns an error if the evaluation was canceled. node is the node
+// being evaluated.
+func (s *state) check(node ast.Node) error {
+	select {
+	case <-s.done:
+		return NewCanceledError(node, s.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+func (s *state) eval(node ast.Node, env *object.Environment) (object.Object, error) {
+	if err := s.step(node); err != nil {
+		return nil, err
+	}
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return s.evalProgram(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return s.evalBlockStatement(node, env)
 	case *ast.VarStatement:
-		return evalVarStatement(node, env)
+		return s.evalVarStatement(node, env)
 	case *ast.ReturnStatement:
-		return evalReturnStatement(node, env)
+		return s.evalReturnStatement(node, env)
+	case *ast.AssignStatement:
+		return s.evalAssignStatement(node, env)
+	case *ast.WhileStatement:
+		return s.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return s.evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return s.evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return object.Break, nil
+	case *ast.ContinueStatement:
+		return object.Continue, nil
 	case *ast.ExpressionStatement:
-		return Eval(node.Value, env)
+		return s.eval(node.Value, env)
 	case *ast.PrefixExpression:
-		return evalPrefixExpression(node, env)
+		return s.evalPrefixExpression(node, env)
 	case *ast.InfixExpression:
-		return evalInfixExpression(node, env)
+		return s.evalInfixExpression(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return s.evalIfExpression(node, env)
 	case *ast.Function:
-		return evalFunction(node, env), nil
+		return s.evalFunction(node, env), nil
 	case *ast.CallExpression:
-		return evalCallExpression(node, env)
+		return s.evalCallExpression(node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return s.evalIdentifier(node, env)
 	case *ast.Integer:
 		return &object.Integer{Value: node.Value}, nil
+	case *ast.Float:
+		return &object.Float{Value: node.Value}, nil
 	case *ast.Boolean:
 		return evalBoolean(node.Value), nil
 	case *ast.String:
-		return &object.String{Value: node.Value}, nil
+		str := &object.String{Value: node.Value}
+		if err := s.checkSize(node, str); err != nil {
+			return nil, err
+		}
+		return str, nil
 	case *ast.Array:
-		return evalArray(node, env)
+		return s.evalArray(node, env)
 	case *ast.IndexExpression:
-		return evalIndex(node, env)
+		return s.evalIndex(node, env)
 	case *ast.Hash:
-		return evalHash(node, env)
+		return s.evalHash(node, env)
 	default:
-		return nil, fmt.Errorf("cannot evaluate %T", node)
+		return nil, &RuntimeError{Node: node, Msg: fmt.Sprintf("cannot evaluate %T", node)}
 	}
 }
 
-func evalProgram(node *ast.Program, env *object.Environment) (object.Object, error) {
+func (s *state) evalProgram(node *ast.Program, env *object.Environment) (object.Object, error) {
 	if len(node.Statements) == 0 {
 		return object.Null, nil
 	}
 	var result object.Object
 	var err error
 	for _, stat := range node.Statements {
-		result, err = Eval(stat, env)
+		result, err = s.eval(stat, env)
 		if err != nil {
 			return nil, err
 		}
@@ -68,137 +179,320 @@ func evalProgram(node *ast.Program, env *object.Environment) (object.Object, err
 	return result, nil
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) (object.Object, error) {
+func (s *state) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) (object.Object, error) {
 	if len(block.Statements) == 0 {
 		return object.Null, nil
 	}
 	var result object.Object
 	var err error
 	for _, stat := range block.Statements {
-		result, err = Eval(stat, env)
+		result, err = s.eval(stat, env)
 		if err != nil {
 			return nil, err
 		}
-		if result.Type() == object.ObjReturnValue {
+		switch result.Type() {
+		case object.ObjReturnValue, object.ObjBreak, object.ObjContinue:
 			return result, nil
 		}
 	}
 	return result, nil
 }
 
-func evalVarStatement(node *ast.VarStatement, env *object.Environment) (object.Object, error) {
-	o, err := Eval(node.Value, env)
+func (s *state) evalVarStatement(node *ast.VarStatement, env *object.Environment) (object.Object, error) {
+	o, err := s.eval(node.Value, env)
 	if err != nil {
 		return nil, err
 	}
-	env.Set(node.Name.Value, o)
+	s.setVariable(node.Name, o, env)
 	return o, nil
 }
 
-func evalReturnStatement(node *ast.ReturnStatement, env *object.Environment) (object.Object, error) {
-	o, err := Eval(node.Value, env)
+func (s *state) evalReturnStatement(node *ast.ReturnStatement, env *object.Environment) (object.Object, error) {
+	o, err := s.eval(node.Value, env)
 	if err != nil {
 		return nil, err
 	}
 	return &object.ReturnValue{Value: o}, nil
 }
 
-func evalPrefixExpression(n *ast.PrefixExpression, env *object.Environment) (object.Object, error) {
-	value, err := Eval(n.Value, env)
+// evalAssignStatement updates the nearest existing binding of an identifier,
+// or an element of an array or a hash, and returns the assigned value.
+func (s *state) evalAssignStatement(node *ast.AssignStatement, env *object.Environment) (object.Object, error) {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current, ok := s.variable(target, env)
+		if !ok {
+			return nil, errorf(target, "assignment to undeclared variable %v", target.Value)
+		}
+		o, err := s.evalAssignedValue(node, current, env)
+		if err != nil {
+			return nil, err
+		}
+		if target.Local {
+			s.frame.Up(target.Depth).Slots[target.Slot] = o
+		} else {
+			env.Assign(target.Value, o)
+		}
+		return o, nil
+	case *ast.IndexExpression:
+		return s.evalIndexAssignment(node, target, env)
+	default:
+		return nil, errorf(node, "cannot assign to %v", node.Target)
+	}
+}
+
+// evalAssignedValue evaluates the right hand side of an assignment. For a
+// compound assignment such as "x += 1", it is combined with current, the
+// value of the target before the assignment.
+func (s *state) evalAssignedValue(node *ast.AssignStatement, current object.Object, env *object.Environment) (object.Object, error) {
+	o, err := s.eval(node.Value, env)
+	if err != nil {
+		return nil, err
+	}
+	if node.Op == "=" {
+		return o, nil
+	}
+	op := node.Op[:len(node.Op)-1]
+	o, err = Infix(node, op, current, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSize(node, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// evalIndexAssignment sets an element of an array or a hash. The container,
+// the index and the value are evaluated in that order.
+func (s *state) evalIndexAssignment(node *ast.AssignStatement, target *ast.IndexExpression, env *object.Environment) (object.Object, error) {
+	leftObj, err := s.eval(target.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	indexObj, err := s.eval(target.Index, env)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := IndexAssignable(target, leftObj, indexObj)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.limits.CheckInsert(node, leftObj, indexObj); err != nil {
+		return nil, err
+	}
+	o, err := s.evalAssignedValue(node, current, env)
+	if err != nil {
+		return nil, err
+	}
+	SetIndex(leftObj, indexObj, o)
+	return o, nil
+}
+
+func (s *state) evalPrefixExpression(n *ast.PrefixExpression, env *object.Environment) (object.Object, error) {
+	value, err := s.eval(n.Value, env)
+	if err != nil {
+		return nil, err
+	}
+	return Prefix(n, value)
+}
+
+// Prefix applies the prefix operator of n to value.
+func Prefix(n *ast.PrefixExpression, value object.Object) (object.Object, error) {
 	switch n.Op {
 	case "!":
 		boolean, ok := value.(*object.Boolean)
 		if !ok {
-			return nil, fmt.Errorf("'!' only works on boolean value")
+			return nil, errorf(n, "'!' only works on boolean value")
 		}
 		return evalBoolean(!boolean.Value), nil
 	case "-":
-		integer, ok := value.(*object.Integer)
-		if !ok {
-			return nil, fmt.Errorf("'-' only works on integer value")
+		switch value := value.(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -value.Value}, nil
+		case *object.Float:
+			return &object.Float{Value: -value.Value}, nil
+		default:
+			return nil, errorf(n, "'-' only works on number value")
 		}
-		return &object.Integer{Value: -integer.Value}, nil
 	default:
-		return nil, fmt.Errorf("unknown prefix operator: %v", n.Op)
+		return nil, errorf(n, "unknown prefix operator: %v", n.Op)
 	}
 }
 
-func evalInfixExpression(n *ast.InfixExpression, env *object.Environment) (object.Object, error) {
-	left, err := Eval(n.Left, env)
+func (s *state) evalInfixExpression(n *ast.InfixExpression, env *object.Environment) (object.Object, error) {
+	if n.Op == "&&" || n.Op == "||" {
+		return s.evalLogicalExpression(n, env)
+	}
+	left, err := s.eval(n.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.eval(n.Right, env)
 	if err != nil {
 		return nil, err
 	}
-	right, err := Eval(n.Right, env)
+	o, err := Infix(n, n.Op, left, right)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkSize(n, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Infix applies the binary operator op to left and right. Errors are reported
+// at n.
+func Infix(n ast.Node, op ast.Operator, left, right object.Object) (object.Object, error) {
 	switch {
 	case left.Type() == object.ObjInteger && right.Type() == object.ObjInteger:
-		return evalIntegerInfixExpression(n.Op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+		return evalIntegerInfixExpression(n, op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+	case isNumber(left) && isNumber(right):
+		// An integer operand is promoted to float if the other one is a float.
+		return evalFloatInfixExpression(n, op, toFloat(left), toFloat(right))
 	case left.Type() == object.ObjBoolean && right.Type() == object.ObjBoolean:
-		return evalBooleanInfixExpression(n.Op, left.(*object.Boolean).Value, right.(*object.Boolean).Value)
+		return evalBooleanInfixExpression(n, op, left.(*object.Boolean).Value, right.(*object.Boolean).Value)
 	case left.Type() == object.ObjString && right.Type() == object.ObjString:
-		return evalStringInfixExpression(n.Op, left.(*object.String).Value, right.(*object.String).Value)
+		return evalStringInfixExpression(n, op, left.(*object.String).Value, right.(*object.String).Value)
 	default:
-		return nil, fmt.Errorf("unsupported operator %v for operands %v and %v", n.Op, left, right)
+		return nil, errorf(n, "unsupported operator %v for operands %v and %v", op, left, right)
+	}
+}
+
+// evalLogicalExpression evaluates && and ||. The right operand is only
+// evaluated if the left one does not decide the result.
+func (s *state) evalLogicalExpression(n *ast.InfixExpression, env *object.Environment) (object.Object, error) {
+	left, err := s.eval(n.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	leftBool, ok := left.(*object.Boolean)
+	if !ok {
+		return nil, errorf(n.Left, "'%v' only works on boolean values; got %v", n.Op, left)
 	}
+	if leftBool.Value == (n.Op == "||") {
+		return leftBool, nil
+	}
+	right, err := s.eval(n.Right, env)
+	if err != nil {
+		return nil, err
+	}
+	rightBool, ok := right.(*object.Boolean)
+	if !ok {
+		return nil, errorf(n.Right, "'%v' only works on boolean values; got %v", n.Op, right)
+	}
+	return rightBool, nil
 }
 
-func evalIfExpression(ifExpression *ast.IfExpression, env *object.Environment) (object.Object, error) {
-	cond, err := Eval(ifExpression.Condition, env)
+func (s *state) evalIfExpression(ifExpression *ast.IfExpression, env *object.Environment) (object.Object, error) {
+	cond, err := s.eval(ifExpression.Condition, env)
 	if err != nil {
 		return nil, err
 	}
 	condBool, ok := cond.(*object.Boolean)
 	if !ok {
-		return nil, fmt.Errorf("non-boolean value for the if expression")
+		return nil, errorf(ifExpression.Condition, "non-boolean value for the if expression")
 	}
 	if condBool.Value {
-		return evalBlockStatement(ifExpression.Consequence, env)
+		return s.evalBlockStatement(ifExpression.Consequence, env)
 	} else {
 		if ifExpression.Alternative == nil {
 			return object.Null, nil
 		} else {
-			return evalBlockStatement(ifExpression.Alternative, env)
+			return s.evalBlockStatement(ifExpression.Alternative, env)
 		}
 	}
 }
 
-func evalFunction(fn *ast.Function, env *object.Environment) object.Object {
+func (s *state) evalFunction(fn *ast.Function, env *object.Environment) object.Object {
 	return &object.Function{
+		Name:       fn.Name,
 		Parameters: fn.Parameters,
 		Body:       fn.Body,
+		NumSlots:   fn.NumSlots,
 		Env:        env,
+		Frame:      s.frame,
 	}
 }
 
-func evalCallExpression(call *ast.CallExpression, env *object.Environment) (object.Object, error) {
-	functionObj, err := Eval(call.Function, env)
+func (s *state) evalCallExpression(call *ast.CallExpression, env *object.Environment) (object.Object, error) {
+	functionObj, err := s.eval(call.Function, env)
 	if err != nil {
 		return nil, err
 	}
-	exprs, err := evalExpressions(call.Arguments, env)
+	exprs, err := s.evalExpressions(call.Arguments, env)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.check(call); err != nil {
+		return nil, err
+	}
+
 	switch functionObj := functionObj.(type) {
 	case *object.Function:
 		if len(functionObj.Parameters) != len(call.Arguments) {
-			return nil, fmt.Errorf("function expects %v parameter; %v provided", len(functionObj.Parameters), len(call.Arguments))
+			return nil, errorf(call, "function expects %v parameter; %v provided", len(functionObj.Parameters), len(call.Arguments))
+		}
+		if call.Tail && functionObj == s.function {
+			// The caller is replaced rather than called again; see callFunction.
+			return &tailCall{args: exprs}, nil
+		}
+		if max := s.limits.MaxDepth; max > 0 && s.depth >= max {
+			return nil, NewLimitError(call, DepthLimit, int64(max))
 		}
-		enclosedEnv := object.NewEnclosedEnvironment(functionObj.Env)
-		for i := range functionObj.Parameters {
-			enclosedEnv.Set(functionObj.Parameters[i].Value, exprs[i])
+		o, err := s.callFunction(call, functionObj, exprs)
+		if err != nil {
+			name := functionObj.Name
+			if name == "" {
+				name = "<anonymous>"
+			}
+			return nil, addFrame(err, name, call)
 		}
-		return unwrapReturnObject(evalBlockStatement(functionObj.Body, enclosedEnv))
+		return o, nil
 	case *object.Builtin:
-		return functionObj.Fn(exprs...), nil
+		o, err := CallBuiltin(s.ctx, call, functionObj, exprs)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkSize(call, o); err != nil {
+			return nil, err
+		}
+		return o, nil
 	default:
-		return nil, fmt.Errorf("unknown type of function %T", functionObj)
+		return nil, errorf(call.Function, "unknown type of function %T", functionObj)
+	}
+}
+
+// callFunction calls fn with args. A call of fn by itself in tail position
+// evaluates to a tailCall, upon which the body is evaluated again with the new
+// arguments in a loop, so that such recursion runs in constant stack space.
+func (s *state) callFunction(call *ast.CallExpression, fn *object.Function, args []object.Object) (object.Object, error) {
+	caller, callerFrame := s.function, s.frame
+	s.function = fn
+	s.depth++
+	defer func() {
+		s.function, s.frame = caller, callerFrame
+		s.depth--
+	}()
+
+	for {
+		s.frame = object.NewFrame(fn.NumSlots, fn.Frame)
+		copy(s.frame.Slots, args)
+		o, err := unwrapReturnObject(s.evalBlockStatement(fn.Body, fn.Env))
+		if err != nil {
+			return nil, err
+		}
+		tc, ok := o.(*tailCall)
+		if !ok {
+			return o, nil
+		}
+		if err := s.check(call); err != nil {
+			return nil, err
+		}
+		args = tc.args
 	}
 }
 
@@ -213,10 +507,10 @@ func unwrapReturnObject(o object.Object, err error) (object.Object, error) {
 	return o, nil
 }
 
-func evalExpressions(exprs []ast.Expression, env *object.Environment) ([]object.Object, error) {
+func (s *state) evalExpressions(exprs []ast.Expression, env *object.Environment) ([]object.Object, error) {
 	var result []object.Object
 	for _, expr := range exprs {
-		o, err := Eval(expr, env)
+		o, err := s.eval(expr, env)
 		if err != nil {
 			return nil, err
 		}
@@ -225,7 +519,7 @@ func evalExpressions(exprs []ast.Expression, env *object.Environment) ([]object.
 	return result, nil
 }
 
-func evalIntegerInfixExpression(op ast.Operator, left, right int64) (object.Object, error) {
+func evalIntegerInfixExpression(n ast.Node, op ast.Operator, left, right int64) (object.Object, error) {
 	switch op {
 	case "+":
 		return &object.Integer{Value: left + right}, nil
@@ -235,7 +529,7 @@ func evalIntegerInfixExpression(op ast.Operator, left, right int64) (object.Obje
 		return &object.Integer{Value: left * right}, nil
 	case "/":
 		if right == 0 {
-			return nil, errors.New("divide by zero")
+			return nil, errorf(n, "divide by zero")
 		}
 		return &object.Integer{Value: left / right}, nil
 	case ">":
@@ -251,26 +545,68 @@ func evalIntegerInfixExpression(op ast.Operator, left, right int64) (object.Obje
 	case "!=":
 		return &object.Boolean{Value: left != right}, nil
 	default:
-		return nil, fmt.Errorf("unexpected operator %v for integer operands", op)
+		return nil, errorf(n, "unexpected operator %v for integer operands", op)
+	}
+}
+
+func evalFloatInfixExpression(n ast.Node, op ast.Operator, left, right float64) (object.Object, error) {
+	switch op {
+	case "+":
+		return &object.Float{Value: left + right}, nil
+	case "-":
+		return &object.Float{Value: left - right}, nil
+	case "*":
+		return &object.Float{Value: left * right}, nil
+	case "/":
+		if right == 0 {
+			return nil, errorf(n, "divide by zero")
+		}
+		return &object.Float{Value: left / right}, nil
+	case ">":
+		return &object.Boolean{Value: left > right}, nil
+	case ">=":
+		return &object.Boolean{Value: left >= right}, nil
+	case "<":
+		return &object.Boolean{Value: left < right}, nil
+	case "<=":
+		return &object.Boolean{Value: left <= right}, nil
+	case "==":
+		return &object.Boolean{Value: left == right}, nil
+	case "!=":
+		return &object.Boolean{Value: left != right}, nil
+	default:
+		return nil, errorf(n, "unexpected operator %v for float operands", op)
 	}
 }
 
-func evalBooleanInfixExpression(op ast.Operator, left, right bool) (object.Object, error) {
+func isNumber(o object.Object) bool {
+	return o.Type() == object.ObjInteger || o.Type() == object.ObjFloat
+}
+
+// toFloat returns the value of an integer or float object as a float.
+func toFloat(o object.Object) float64 {
+	if i, ok := o.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return o.(*object.Float).Value
+}
+
+func evalBooleanInfixExpression(n ast.Node, op ast.Operator, left, right bool) (object.Object, error) {
 	switch op {
 	case "==":
 		return &object.Boolean{Value: left == right}, nil
 	case "!=":
 		return &object.Boolean{Value: left != right}, nil
 	default:
-		return nil, fmt.Errorf("unexpected operator %v for boolean operands", op)
+		return nil, errorf(n, "unexpected operator %v for boolean operands", op)
 	}
 }
 
-func evalStringInfixExpression(op ast.Operator, left, right string) (object.Object, error) {
+func evalStringInfixExpression(n ast.Node, op ast.Operator, left, right string) (object.Object, error) {
 	if op == "+" {
 		return &object.String{Value: left + right}, nil
 	} else {
-		return nil, fmt.Errorf("unexpected operator %v for string operands", op)
+		return nil, errorf(n, "unexpected operator %v for string operands", op)
 	}
 }
 
@@ -282,55 +618,63 @@ func evalBoolean(v bool) object.Object {
 	}
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) (object.Object, error) {
-	o, ok := env.Get(node.Value)
+func (s *state) evalIdentifier(node *ast.Identifier, env *object.Environment) (object.Object, error) {
+	o, ok := s.variable(node, env)
 	if ok {
 		return o, nil
 	}
-	o, ok = builtins[node.Value]
-	if ok {
-		return o, nil
+	// A local that is not set yet does not fall back to a builtin of the same
+	// name: it shadows the builtin in the whole function.
+	if b, ok := LookupBuiltin(node.Value); ok && !node.Local {
+		return b, nil
 	}
-	return nil, fmt.Errorf("undefined identifier %v", node.Value)
+	return nil, errorf(node, "undefined identifier %v", node.Value)
 }
 
-func evalArray(node *ast.Array, env *object.Environment) (object.Object, error) {
+func (s *state) evalArray(node *ast.Array, env *object.Environment) (object.Object, error) {
 	arr := &object.Array{}
 	for _, e := range node.Elements {
-		o, err := Eval(e, env)
+		o, err := s.eval(e, env)
 		if err != nil {
 			return nil, err
 		}
 		arr.Elements = append(arr.Elements, o)
 	}
+	if err := s.checkSize(node, arr); err != nil {
+		return nil, err
+	}
 	return arr, nil
 }
 
-func evalIndex(node *ast.IndexExpression, env *object.Environment) (object.Object, error) {
-	leftObj, err := Eval(node.Left, env)
+func (s *state) evalIndex(node *ast.IndexExpression, env *object.Environment) (object.Object, error) {
+	leftObj, err := s.eval(node.Left, env)
 	if err != nil {
 		return nil, err
 	}
-	indexObj, err := Eval(node.Index, env)
+	indexObj, err := s.eval(node.Index, env)
 	if err != nil {
 		return nil, err
 	}
+	return Index(node, leftObj, indexObj)
+}
 
+// Index returns the element of leftObj at indexObj.
+func Index(node *ast.IndexExpression, leftObj, indexObj object.Object) (object.Object, error) {
 	switch leftObj := leftObj.(type) {
 	case *object.Array:
 		i, ok := indexObj.(*object.Integer)
 		if !ok {
-			return nil, fmt.Errorf("index must be integer; got %T", indexObj)
+			return nil, errorf(node.Index, "index must be integer; got %T", indexObj)
 		}
 
 		if i.Value < 0 || i.Value >= int64(len(leftObj.Elements)) {
-			return nil, fmt.Errorf("index %v out of bound", i.Value)
+			return nil, errorf(node.Index, "index %v out of bound", i.Value)
 		}
 		return leftObj.Elements[i.Value], nil
 	case *object.Hash:
 		hashKey, ok := indexObj.(object.HashKeyer)
 		if !ok {
-			return nil, fmt.Errorf("cannot get hash key from %v", indexObj)
+			return nil, errorf(node.Index, "cannot get hash key from %v", indexObj)
 		}
 		p, ok := leftObj.Hash[hashKey.HashKey()]
 		if !ok {
@@ -338,33 +682,53 @@ func evalIndex(node *ast.IndexExpression, env *object.Environment) (object.Objec
 		}
 		return p.V, nil
 	default:
-		return nil, fmt.Errorf("index operation on non array object %T", leftObj)
+		return nil, errorf(node, "index operation on non array object %T", leftObj)
 	}
 }
 
-func evalHash(node *ast.Hash, env *object.Environment) (object.Object, error) {
-	h := &object.Hash{Hash: make(map[object.HashKey]*object.HashPair)}
+func (s *state) evalHash(node *ast.Hash, env *object.Environment) (object.Object, error) {
+	h := object.NewHash()
 
-	for k, v := range node.Value {
-		kObj, err := Eval(k, env)
+	for _, p := range node.Pairs {
+		kObj, err := s.eval(p.Key, env)
 		if err != nil {
 			return nil, err
 		}
-		hashKey, ok := kObj.(object.HashKeyer)
-		if !ok {
-			return nil, fmt.Errorf("cannot get hash key from %v", k)
+		if _, ok := kObj.(object.HashKeyer); !ok {
+			return nil, errorf(p.Key, "cannot get hash key from %v", kObj)
 		}
 
-		vObj, err := Eval(v, env)
+		vObj, err := s.eval(p.Value, env)
 		if err != nil {
 			return nil, err
 		}
 
-		h.Hash[hashKey.HashKey()] = &object.HashPair{
-			K: kObj,
-			V: vObj,
-		}
+		h.Set(kObj, vObj)
 	}
 
+	if err := s.checkSize(node, h); err != nil {
+		return nil, err
+	}
 	return h, nil
 }
+
+// variable returns the value of the variable id is bound to: a local in the
+// frame of the current call or of an enclosing one, or a global of env. It
+// reports false if the variable is not set.
+func (s *state) variable(id *ast.Identifier, env *object.Environment) (object.Object, bool) {
+	if id.Local {
+		o := s.frame.Up(id.Depth).Slots[id.Slot]
+		return o, o != nil
+	}
+	return env.Get(id.Value)
+}
+
+// setVariable declares the variable id is bound to, or sets it if it was
+// declared already, to o.
+func (s *state) setVariable(id *ast.Identifier, o object.Object, env *object.Environment) {
+	if id.Local {
+		s.frame.Up(id.Depth).Slots[id.Slot] = o
+		return
+	}
+	env.Set(id.Value, o)
+}
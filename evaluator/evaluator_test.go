@@ -1,9 +1,16 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/evaluator/evaltest"
 	"github.com/wangkekekexili/mankey/lexer"
 	"github.com/wangkekekexili/mankey/object"
 	"github.com/wangkekekexili/mankey/parser"
@@ -17,6 +24,15 @@ func eval(code string) (object.Object, error) {
 	return Eval(program, object.NewEnvironment())
 }
 
+// runTests evaluates the programs of tests and checks their results.
+func runTests(t *testing.T, tests []evaltest.Test) {
+	for _, test := range tests {
+		if err := test.Check(eval(test.Code)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 func assertIntegerObject(o object.Object, v int64) error {
 	integer, ok := o.(*object.Integer)
 	if !ok {
@@ -28,217 +44,68 @@ func assertIntegerObject(o object.Object, v int64) error {
 	return nil
 }
 
-func assertBoolObject(o object.Object, v bool) error {
-	boolean, ok := o.(*object.Boolean)
+func assertFloatObject(o object.Object, v float64) error {
+	f, ok := o.(*object.Float)
 	if !ok {
-		return fmt.Errorf("expected to get a boolean object; got %T", o)
+		return fmt.Errorf("expected to get a float object; got %T", o)
 	}
-	if boolean.Value != v {
-		return fmt.Errorf("got boolean value %v; want %v", boolean.Value, v)
+	if f.Value != v {
+		return fmt.Errorf("got float value %v; want %v", f.Value, v)
 	}
 	return nil
 }
 
-func assertStringObject(o object.Object, v string) error {
-	str, ok := o.(*object.String)
-	if !ok {
-		return fmt.Errorf("expected to get a string object; got %T", o)
-	}
-	if str.Value != v {
-		return fmt.Errorf("got string value %v; want %v", str.Value, v)
-	}
-	return nil
+func TestEvalInteger(t *testing.T) {
+	runTests(t, evaltest.Integers)
 }
 
-func assertNullIntBool(o object.Object, v interface{}) error {
-	if v == nil {
-		if o == object.Null {
-			return nil
-		} else {
-			return fmt.Errorf("expected to get null; got %v", o)
-		}
-	}
-	switch v := v.(type) {
-	case int:
-		return assertIntegerObject(o, int64(v))
-	case bool:
-		return assertBoolObject(o, v)
-	default:
-		return fmt.Errorf("bug in test: unexpected type %T", v)
-	}
+func TestEvalFloat(t *testing.T) {
+	runTests(t, evaltest.Floats)
 }
 
-func TestEvalInteger(t *testing.T) {
-	tests := []struct {
-		code   string
-		expInt int64
-	}{
-		{"5", 5},
-		{"-5", -5},
-		{"--5", 5},
-		{"---5", -5},
-		{"42", 42},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"-50 + 100 + -50", 0},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"20 + 2 * -10", 0},
-		{"50 / 2 * 2 + 10", 60},
-		{"2 * (5 + 10)", 30},
-		{"3 * 3 * 3 + 10", 37},
-		{"3 * (3 * 3) + 10", 37},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
+func TestEvalFloatComparison(t *testing.T) {
+	runTests(t, evaltest.FloatComparisons)
+}
+
+// TestEvalFloatText checks that the text of float literals, including the
+// values that have no literal, evaluates to their values.
+func TestEvalFloatText(t *testing.T) {
+	for _, v := range []float64{0, 1.5, -2, 1e100, math.MaxFloat64, math.Inf(1), math.Inf(-1), math.NaN()} {
+		text := (&ast.Float{Value: v}).String()
+		o, err := eval(text)
 		if err != nil {
-			t.Fatal(err)
+			t.Errorf("eval %v: %v", text, err)
+			continue
 		}
-		err = assertIntegerObject(o, test.expInt)
-		if err != nil {
-			t.Fatal(err)
+		f, ok := o.(*object.Float)
+		if !ok || f.Value != v && !(math.IsNaN(v) && math.IsNaN(f.Value)) {
+			t.Errorf("eval %v: got %v; want %v", text, o, v)
 		}
 	}
 }
 
+func TestBuiltinInt(t *testing.T) {
+	runTests(t, evaltest.BuiltinInt)
+}
+
 func TestEvalBoolean(t *testing.T) {
-	tests := []struct {
-		code    string
-		expBool bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"!false", true},
-		{"!!false", false},
-		{"!true", false},
-		{"!!true", true},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"true == true", true},
-		{"false == false", true},
-		{"true == false", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertBoolObject(o, test.expBool)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.Booleans)
 }
 
 func TestEvalString(t *testing.T) {
-	tests := []struct {
-		code   string
-		expStr string
-	}{
-		{`"hello"`, "hello"},
-		{`"hello" + " " + "world"`, "hello world"},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertStringObject(o, test.expStr)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.Strings)
 }
 
 func TestEvalIfElseExpression(t *testing.T) {
-	tests := []struct {
-		code string
-		exp  interface{}
-	}{
-		{"if (true) { 10 }", 10},
-		{"if (false) { 10; }", nil},
-		{"if (1 < 2) { 10; }", 10},
-		{"if (1 > 2) { 10 }", nil},
-		{"if (1 > 2) { true } else { false }", false},
-		{"if (1 < 2) { true } else { false }", true},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertNullIntBool(o, test.exp)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.IfElse)
 }
 
 func TestReturnStatements(t *testing.T) {
-	tests := []struct {
-		code   string
-		expInt int64
-	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{
-			code: `
-if (true) {
-  if (true) {
-    return 42;
-  }
-}
-return 10;
-`,
-			expInt: 42,
-		},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertIntegerObject(o, test.expInt)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.Returns)
 }
 
 func TestEvalVarStatement(t *testing.T) {
-	tests := []struct {
-		code   string
-		expInt int64
-	}{
-		{"var n = 42;", 42},
-		{"var n = 42; n+1", 43},
-		{"var n = 42; var m = n - 2; m", 40},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertIntegerObject(o, test.expInt)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.Vars)
 }
 
 func TestEvalFunction(t *testing.T) {
@@ -259,42 +126,38 @@ func TestEvalFunction(t *testing.T) {
 }
 
 func TestCallExpression(t *testing.T) {
-	tests := []struct {
-		code   string
-		expInt int64
-	}{
-		{"var fn = func(x) {return x;};fn(42)", 42},
-		{"var double = func(x) { x * 2; }; double(5);", 10},
-		{"var add = func(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertIntegerObject(o, test.expInt)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.Calls)
 }
 
 func TestError(t *testing.T) {
-	codes := []string{
-		"!10",
-		"-true",
-		"true + false",
-		"if (1) {1}",
-		"foobar",
+	runTests(t, evaltest.Errors)
+}
+
+func TestComments(t *testing.T) {
+	code := `
+// double returns twice x.
+var double = func(x) {
+	x * 2 /* the /* nested */ factor */
+};
+double(21) // 42`
+	o, err := eval(code)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, code := range codes {
-		_, err := eval(code)
-		if err == nil {
-			t.Fatal("error expected")
-		}
+	err = assertIntegerObject(o, 42)
+	if err != nil {
+		t.Fatal(err)
 	}
 }
 
+func TestErrorPosition(t *testing.T) {
+	runTests(t, evaltest.ErrorPositions)
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	runTests(t, evaltest.UndefinedVariables)
+}
+
 func TestClosures(t *testing.T) {
 	code := `
 var newAdder = func(x) {
@@ -310,25 +173,7 @@ addTwo(9);`
 }
 
 func TestBuiltinLen(t *testing.T) {
-	tests := []struct {
-		code   string
-		expInt int64
-	}{
-		{`len("")`, 0},
-		{`len("42")`, 2},
-		{`len("hello world")`, 11},
-		{`var a = "ke"; len(a)`, 2},
-	}
-	for _, test := range tests {
-		o, err := eval(test.code)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = assertIntegerObject(o, test.expInt)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	runTests(t, evaltest.BuiltinLen)
 }
 
 func TestEvalArray(t *testing.T) {
@@ -346,38 +191,324 @@ func TestEvalArray(t *testing.T) {
 }
 
 func TestEvalIndex(t *testing.T) {
-	tests := []struct {
-		code   string
-		expInt int64
-	}{
-		{"[1][0]", 1},
-		{"[1,2][1]", 2},
-		{"var ages = [15, 26, 17];ages[1]", 26},
-		{"{true: 42}[true]", 42},
-		{"{1: 10, 2: 100}[2]", 100},
+	runTests(t, evaltest.Index)
+}
+
+func TestEvalHash(t *testing.T) {
+	runTests(t, evaltest.Hashes)
+}
+
+func TestAssignStatement(t *testing.T) {
+	runTests(t, evaltest.Assignments)
+}
+
+func TestAssignError(t *testing.T) {
+	runTests(t, evaltest.AssignErrors)
+}
+
+func TestLoop(t *testing.T) {
+	runTests(t, evaltest.Loops)
+}
+
+func TestLoopError(t *testing.T) {
+	runTests(t, evaltest.LoopErrors)
+}
+
+func TestRuntimeErrorTraceback(t *testing.T) {
+	code := `var inner = func(x) {
+	x / 0
+};
+var outer = func() {
+	inner(1)
+};
+[func() { outer() }][0]();`
+	_, err := eval(code)
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected a runtime error; got %v", err)
 	}
-	for _, test := range tests {
-		o, err := eval(test.code)
+	if got := rerr.Pos.String(); got != "2:2" {
+		t.Fatalf("got error position %v; want 2:2", got)
+	}
+	if _, ok := rerr.Node.(*ast.InfixExpression); !ok {
+		t.Fatalf("expected the failing node to be an infix expression; got %T", rerr.Node)
+	}
+	expFrames := []string{"inner 5:2", "outer 7:11", "<anonymous> 7:1"}
+	if len(rerr.Frames) != len(expFrames) {
+		t.Fatalf("got frames %v; want %v", rerr.Frames, expFrames)
+	}
+	for i, f := range rerr.Frames {
+		if got := fmt.Sprintf("%v %v", f.Function, f.Pos); got != expFrames[i] {
+			t.Fatalf("got frame %v; want %v", got, expFrames[i])
+		}
+	}
+	expTraceback := `Traceback (most recent call last):
+  7:1: call to <anonymous>
+  7:11: call to outer
+  5:2: call to inner
+2:2: divide by zero`
+	if got := Traceback(err); got != expTraceback {
+		t.Fatalf("got traceback\n%v\nwant\n%v", got, expTraceback)
+	}
+}
+
+func TestBuiltinError(t *testing.T) {
+	runTests(t, evaltest.BuiltinErrors)
+}
+
+func TestBuiltinPanic(t *testing.T) {
+	builtins["explode"] = &object.Builtin{
+		Name: "explode",
+		Fn: func(args ...object.Object) (object.Object, error) {
+			return args[0], nil
+		},
+	}
+	defer delete(builtins, "explode")
+
+	_, err := eval("explode()")
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	exp := "1:1: explode: panic: runtime error: index out of range"
+	if !strings.HasPrefix(err.Error(), exp) {
+		t.Fatalf("got error %q; want prefix %q", err, exp)
+	}
+}
+
+func TestInterpreter(t *testing.T) {
+	in := NewInterpreter()
+	if err := in.Set("rate", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Set("prices", map[string]int{"apple": 10, "pear": 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Register("discount", func(price int, rate float64) float64 {
+		return float64(price) * (1 - rate)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Register("fail", func() error { return fmt.Errorf("failed") }); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := in.Eval(`var total = discount(prices["apple"], rate) + discount(prices["pear"], rate); total`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assertFloatObject(o, 15); err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	if err := in.GetValue("total", &total); err != nil || total != 15 {
+		t.Fatalf("got %v, %v; want 15", total, err)
+	}
+	if err := in.GetValue("missing", &total); err == nil {
+		t.Fatal("expected an error for an undefined global")
+	}
+
+	// Globals persist, and a parsed program can be run several times.
+	program, err := Parse("counter.mk", "var n = n + 1; n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Eval("var n = 0"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		o, err := in.Run(program)
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = assertIntegerObject(o, test.expInt)
+		if err := assertIntegerObject(o, int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = in.Eval("fail()")
+	if err == nil || err.Error() != "1:1: fail: failed" {
+		t.Fatalf("got error %v; want 1:1: fail: failed", err)
+	}
+	_, err = in.Eval(`discount("a", 1)`)
+	if err == nil || err.Error() != "1:1: discount: argument 1: cannot convert String to int" {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestInterpreterStdout(t *testing.T) {
+	var b bytes.Buffer
+	in := NewInterpreter()
+	in.Stdout = &b
+	if _, err := in.Eval(`puts(1, "a"); var f = func() { puts([2]) }; f()`); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "1\na\n[2]\n"; got != want {
+		t.Fatalf("got output %q; want %q", got, want)
+	}
+}
+
+func TestInterpreterLaterGlobals(t *testing.T) {
+	in := NewInterpreter()
+	// isOdd is defined by the next program.
+	if _, err := in.Eval("var isEven = func(n) { if (n == 0) { true } else { isOdd(n - 1) } }"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Eval("var isOdd = func(n) { if (n == 0) { false } else { isEven(n - 1) } }"); err != nil {
+		t.Fatal(err)
+	}
+	o, err := in.Eval("isEven(10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != object.True {
+		t.Fatalf("got %v; want true", o)
+	}
+
+	// A global that is still undefined is reported when it is evaluated.
+	if _, err := in.Eval("var f = func() { later }"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = in.Eval("f()")
+	if err == nil || err.Error() != "1:18: undefined identifier later" {
+		t.Fatalf("got error %v; want 1:18: undefined identifier later", err)
+	}
+
+	// Eval checks a program on its own.
+	program, err := Parse("", "var g = func() { later }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Eval(program, object.NewEnvironment())
+	if err == nil || err.Error() != "1:18: undefined identifier later" {
+		t.Fatalf("got error %v; want 1:18: undefined identifier later", err)
+	}
+}
+
+func TestEvalUnresolved(t *testing.T) {
+	program, err := Parse("", "var f = func(a) { var b = a + 1; b }; f(2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Undo the resolution, as for a program built or changed by hand.
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			n.Local, n.Depth, n.Slot = false, 0, 0
+		case *ast.Function:
+			n.NumSlots = 0
+		}
+		return true
+	})
+	program.Resolved = false
+
+	o, err := Eval(program, object.NewEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assertIntegerObject(o, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !program.Resolved {
+		t.Fatal("expected Eval to resolve the program")
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	codes := []string{
+		"while (true) {}",
+		"for (;;) { continue; }",
+		"var f = func() { 1 }; var g = func() { f() }; while (true) { g() }",
+		"var f = func() { f() }; f()",
+		"var f = func(n) { if (n > 0) { f(n - 1) } else { 0 } }; while (true) { f(100) }",
+	}
+	for _, code := range codes {
+		program, err := parser.New(lexer.New(code)).ParseProgram()
 		if err != nil {
 			t.Fatal(err)
 		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = EvalContext(ctx, program, object.NewEnvironment())
+		cancel()
+		if !IsCanceled(err) {
+			t.Fatalf("expected a cancellation error for %q; got %v", code, err)
+		}
+		if rerr := err.(*RuntimeError); rerr.Err != context.DeadlineExceeded {
+			t.Fatalf("got cause %v; want %v", rerr.Err, context.DeadlineExceeded)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewInterpreter().EvalContext(ctx, "", "var f = func() { 1 }; f()")
+	if !IsCanceled(err) {
+		t.Fatalf("expected a cancellation error; got %v", err)
+	}
+	if exp := "1:23: evaluation canceled: context canceled"; err.Error() != exp {
+		t.Fatalf("got error %q; want %q", err, exp)
+	}
+	if _, err := eval("undefined"); IsCanceled(err) {
+		t.Fatalf("expected %v not to be a cancellation error", err)
 	}
 }
 
-func TestEvalHash(t *testing.T) {
-	o, err := eval("{1:true, 2:false}")
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		code     string
+		limits   Limits
+		expKind  LimitKind
+		expError string
+	}{
+		{"while (true) {}", Limits{MaxSteps: 1000}, StepLimit, "1:8: step limit of 1000 exceeded"},
+		{"var f = func() { 1 + f() }; f()", Limits{MaxDepth: 100}, DepthLimit, "1:22: stack overflow: call depth exceeds 100"},
+		{"var f = func() { 1 + f() }; f()", DefaultLimits, DepthLimit, "1:22: stack overflow: call depth exceeds 10000"},
+		{`var s = "ab"; while (true) { s = s + s; }`, Limits{MaxStringLen: 1000}, StringLimit, "1:34: string longer than 1000 bytes"},
+		{`var s = "ab"; while (true) { s += s; }`, Limits{MaxStringLen: 1000}, StringLimit, "1:30: string longer than 1000 bytes"},
+		{`len("abcdef")`, Limits{MaxStringLen: 3}, StringLimit, "1:5: string longer than 3 bytes"},
+		{"var a = []; while (true) { a = push(a, 1); }", Limits{MaxArrayLen: 10}, ArrayLimit, "1:32: array longer than 10 elements"},
+		{"[1, 2, 3]", Limits{MaxArrayLen: 2}, ArrayLimit, "1:1: array longer than 2 elements"},
+		{"{1: 1, 2: 2, 3: 3}", Limits{MaxHashLen: 2}, HashLimit, "1:1: hash larger than 2 pairs"},
+		{"var h = {}; var i = 0; while (true) { h[i] = i; i += 1; }", Limits{MaxHashLen: 5}, HashLimit, "1:39: hash larger than 5 pairs"},
+	}
+	for _, test := range tests {
+		program, err := parser.New(lexer.New(test.code)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = EvalLimits(context.Background(), program, object.NewEnvironment(), test.limits)
+		l, ok := IsLimitExceeded(err)
+		if !ok {
+			t.Fatalf("expected a limit error for %q; got %v", test.code, err)
+		}
+		if l.Kind != test.expKind {
+			t.Fatalf("got limit %v for %q; want %v", l.Kind, test.code, test.expKind)
+		}
+		if err.Error() != test.expError {
+			t.Fatalf("got error %q; want %q", err, test.expError)
+		}
+	}
+
+	// Within the limits, the program runs normally.
+	in := NewInterpreter()
+	in.Limits = Limits{MaxSteps: 10000, MaxDepth: 10, MaxStringLen: 4, MaxArrayLen: 3, MaxHashLen: 1}
+	o, err := in.Eval(`var h = {1: 2}; var f = func(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(5); len("ab" + "cd") + len([1, 2, 3])`)
 	if err != nil {
 		t.Fatal(err)
 	}
-	arr, ok := o.(*object.Hash)
-	if !ok {
-		t.Fatalf("expected to get a hash object; got %T", o)
+	if err := assertIntegerObject(o, 7); err != nil {
+		t.Fatal(err)
 	}
-	if len(arr.Hash) != 2 {
-		t.Fatalf("2 elements expected; got %v", arr.Hash)
+
+	// The traceback of a stack overflow elides most of the frames.
+	_, err = eval("var f = func() { 1 + f() }; f()")
+	traceback := Traceback(err)
+	if n := strings.Count(traceback, "\n"); n != 2*tracebackFrames+2 {
+		t.Fatalf("got %v lines in traceback; want %v:\n%v", n+1, 2*tracebackFrames+3, traceback)
 	}
+	if !strings.Contains(traceback, "  ... 9980 more calls ...\n") {
+		t.Fatalf("expected elided frames in traceback:\n%v", traceback)
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	runTests(t, evaltest.TailCalls)
 }
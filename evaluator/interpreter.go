@@ -0,0 +1,136 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/object"
+	"github.com/wangkekekexili/mankey/parser"
+)
+
+// Interpreter evaluates programs in a persistent global environment. It is
+// the entry point for Go programs embedding mankey: Go functions and values
+// can be made available to scripts as globals, and results read back.
+//
+// A program may use globals that a later program defines, so an undefined
+// global is reported when it is evaluated rather than before the program
+// runs as with Eval.
+type Interpreter struct {
+	env *object.Environment
+
+	// Limits bounds the resources used by each evaluation.
+	Limits Limits
+
+	// Stdout is where the builtin puts writes, os.Stdout if nil.
+	Stdout io.Writer
+}
+
+// NewInterpreter returns an interpreter with an empty global environment and
+// the default limits.
+func NewInterpreter() *Interpreter {
+	return &Interpreter{env: object.NewEnvironment(), Limits: DefaultLimits}
+}
+
+// Env returns the global environment of the interpreter.
+func (in *Interpreter) Env() *object.Environment {
+	return in.env
+}
+
+// Set binds name to the Go value v, converted with object.FromGo.
+func (in *Interpreter) Set(name string, v interface{}) error {
+	o, err := object.FromGo(v)
+	if err != nil {
+		return fmt.Errorf("cannot set %v: %v", name, err)
+	}
+	if b, ok := o.(*object.Builtin); ok && b.Name == "" {
+		b.Name = name
+	}
+	in.env.Set(name, o)
+	return nil
+}
+
+// Register makes the Go function fn callable from scripts as name. See
+// object.NewBuiltin for how arguments and results are converted.
+func (in *Interpreter) Register(name string, fn interface{}) error {
+	b, err := object.NewBuiltin(name, fn)
+	if err != nil {
+		return fmt.Errorf("cannot register %v: %v", name, err)
+	}
+	in.env.Set(name, b)
+	return nil
+}
+
+// Get returns the value of the global name.
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+	return in.env.Get(name)
+}
+
+// GetValue stores the value of the global name in the Go value pointed to by
+// ptr, converted with object.ToGo.
+func (in *Interpreter) GetValue(name string, ptr interface{}) error {
+	o, ok := in.env.Get(name)
+	if !ok {
+		return fmt.Errorf("undefined identifier %v", name)
+	}
+	if err := object.ToGo(o, ptr); err != nil {
+		return fmt.Errorf("cannot get %v: %v", name, err)
+	}
+	return nil
+}
+
+// Eval parses and evaluates src.
+func (in *Interpreter) Eval(src string) (object.Object, error) {
+	program, err := Parse("", src)
+	if err != nil {
+		return nil, err
+	}
+	return in.Run(program)
+}
+
+// EvalFile parses and evaluates src, the content of the script file
+// filename, like ParseFile.
+func (in *Interpreter) EvalFile(filename, src string) (object.Object, error) {
+	return in.EvalContext(context.Background(), filename, src)
+}
+
+// EvalContext is like EvalFile but stops the evaluation when ctx is done.
+func (in *Interpreter) EvalContext(ctx context.Context, filename, src string) (object.Object, error) {
+	program, err := ParseFile(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	return in.RunContext(ctx, program)
+}
+
+// Run evaluates a program parsed beforehand, which can be run any number of
+// times. Like EvalLimits, it resolves program first unless it is resolved
+// already.
+func (in *Interpreter) Run(program *ast.Program) (object.Object, error) {
+	return in.RunContext(context.Background(), program)
+}
+
+// RunContext is like Run but stops the evaluation when ctx is done.
+func (in *Interpreter) RunContext(ctx context.Context, program *ast.Program) (object.Object, error) {
+	resolve(program)
+	if in.Stdout != nil {
+		ctx = WithStdout(ctx, in.Stdout)
+	}
+	return evaluate(ctx, program, in.env, in.Limits)
+}
+
+// Parse parses src, reporting positions in filename. The error, if any, is a
+// parser.ErrorList.
+func Parse(filename, src string) (*ast.Program, error) {
+	return parser.New(lexer.NewFile(filename, src)).ParseProgram()
+}
+
+// ParseFile is like Parse for src read from the script file filename, whose
+// leading "#!" line, if any, is skipped.
+func ParseFile(filename, src string) (*ast.Program, error) {
+	r := lexer.NewFile(filename, src)
+	r.SetMode(lexer.SkipShebang)
+	return parser.New(r).ParseProgram()
+}
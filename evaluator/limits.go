@@ -0,0 +1,145 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/object"
+)
+
+// Limits bounds the resources an evaluation may use. A zero field means no
+// limit.
+type Limits struct {
+	MaxSteps     int64 // number of nodes evaluated
+	MaxDepth     int   // depth of nested function calls
+	MaxStringLen int   // length in bytes of a string produced by the program
+	MaxArrayLen  int   // number of elements of an array produced by the program
+	MaxHashLen   int   // number of pairs of a hash produced by the program
+}
+
+// DefaultLimits are the limits used by Eval and EvalContext. They only stop
+// runaway recursion before it exhausts the Go stack.
+var DefaultLimits = Limits{
+	MaxDepth: 10000,
+}
+
+// LimitKind identifies the limit exceeded by a LimitError.
+type LimitKind int
+
+const (
+	StepLimit LimitKind = iota + 1
+	DepthLimit
+	StringLimit
+	ArrayLimit
+	HashLimit
+)
+
+var limitKindNames = map[LimitKind]string{
+	StepLimit:   "step limit",
+	DepthLimit:  "depth limit",
+	StringLimit: "string length limit",
+	ArrayLimit:  "array length limit",
+	HashLimit:   "hash length limit",
+}
+
+func (k LimitKind) String() string {
+	if name, ok := limitKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("LimitKind(%d)", int(k))
+}
+
+// LimitError is the cause of a RuntimeError reporting that a limit was
+// exceeded.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case StepLimit:
+		return fmt.Sprintf("step limit of %v exceeded", e.Limit)
+	case DepthLimit:
+		return fmt.Sprintf("stack overflow: call depth exceeds %v", e.Limit)
+	case StringLimit:
+		return fmt.Sprintf("string longer than %v bytes", e.Limit)
+	case ArrayLimit:
+		return fmt.Sprintf("array longer than %v elements", e.Limit)
+	case HashLimit:
+		return fmt.Sprintf("hash larger than %v pairs", e.Limit)
+	default:
+		return fmt.Sprintf("%v of %v exceeded", e.Kind, e.Limit)
+	}
+}
+
+// IsLimitExceeded returns the LimitError that caused err, if err is a
+// RuntimeError reporting an exceeded limit.
+func IsLimitExceeded(err error) (*LimitError, bool) {
+	e, ok := err.(*RuntimeError)
+	if !ok {
+		return nil, false
+	}
+	l, ok := e.Err.(*LimitError)
+	return l, ok
+}
+
+// NewLimitError returns a RuntimeError at node reporting that the limit of the
+// given kind was exceeded.
+func NewLimitError(node ast.Node, kind LimitKind, limit int64) error {
+	l := &LimitError{Kind: kind, Limit: limit}
+	return &RuntimeError{
+		Node: node,
+		Pos:  node.Pos(),
+		Msg:  l.Error(),
+		Err:  l,
+	}
+}
+
+// step counts the evaluation of node against the step limit.
+func (s *state) step(node ast.Node) error {
+	s.steps++
+	if max := s.limits.MaxSteps; max > 0 && s.steps > max {
+		return NewLimitError(node, StepLimit, max)
+	}
+	return nil
+}
+
+func (s *state) checkSize(node ast.Node, o object.Object) error {
+	return s.limits.CheckSize(node, o)
+}
+
+// CheckSize returns an error if o, produced by node, is larger than the
+// limits allow.
+func (l Limits) CheckSize(node ast.Node, o object.Object) error {
+	switch o := o.(type) {
+	case *object.String:
+		if max := l.MaxStringLen; max > 0 && len(o.Value) > max {
+			return NewLimitError(node, StringLimit, int64(max))
+		}
+	case *object.Array:
+		if max := l.MaxArrayLen; max > 0 && len(o.Elements) > max {
+			return NewLimitError(node, ArrayLimit, int64(max))
+		}
+	case *object.Hash:
+		if max := l.MaxHashLen; max > 0 && len(o.Hash) > max {
+			return NewLimitError(node, HashLimit, int64(max))
+		}
+	}
+	return nil
+}
+
+// CheckInsert returns an error if setting the element of left at index, as
+// node does, would make a hash larger than the limits allow. index must have
+// been checked by IndexAssignable.
+func (l Limits) CheckInsert(node ast.Node, left, index object.Object) error {
+	h, ok := left.(*object.Hash)
+	max := l.MaxHashLen
+	if !ok || max <= 0 || len(h.Hash) < max {
+		return nil
+	}
+	if _, ok := h.Hash[index.(object.HashKeyer).HashKey()]; ok {
+		return nil
+	}
+	return NewLimitError(node, HashLimit, int64(max))
+}
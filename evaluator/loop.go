@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/object"
+)
+
+// Loops do not introduce a new scope: like the blocks of an if expression,
+// their bodies are evaluated in the enclosing environment. A loop statement
+// evaluates to null unless a return statement leaves it.
+
+func (s *state) evalWhileStatement(node *ast.WhileStatement, env *object.Environment) (object.Object, error) {
+	for {
+		cond, err := s.evalLoopCondition(node.Condition, env)
+		if err != nil {
+			return nil, err
+		}
+		if !cond {
+			return object.Null, nil
+		}
+		result, done, err := s.evalLoopBody(node.Body, env)
+		if done || err != nil {
+			return result, err
+		}
+	}
+}
+
+func (s *state) evalForStatement(node *ast.ForStatement, env *object.Environment) (object.Object, error) {
+	if node.Init != nil {
+		if _, err := s.eval(node.Init, env); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if node.Condition != nil {
+			cond, err := s.evalLoopCondition(node.Condition, env)
+			if err != nil {
+				return nil, err
+			}
+			if !cond {
+				return object.Null, nil
+			}
+		}
+		result, done, err := s.evalLoopBody(node.Body, env)
+		if done || err != nil {
+			return result, err
+		}
+		if node.Post != nil {
+			if _, err := s.eval(node.Post, env); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (s *state) evalForInStatement(node *ast.ForInStatement, env *object.Environment) (object.Object, error) {
+	iterable, err := s.eval(node.Iterable, env)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := ForInItems(node, iterable)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		s.setVariable(node.Variable, item, env)
+		result, done, err := s.evalLoopBody(node.Body, env)
+		if done || err != nil {
+			return result, err
+		}
+	}
+	return object.Null, nil
+}
+
+func (s *state) evalLoopCondition(cond ast.Expression, env *object.Environment) (bool, error) {
+	o, err := s.eval(cond, env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := o.(*object.Boolean)
+	if !ok {
+		return false, errorf(cond, "non-boolean value for the loop condition")
+	}
+	return b.Value, nil
+}
+
+// evalLoopBody evaluates one iteration of a loop. done reports whether the
+// loop ends, either because of a break statement or because a return
+// statement leaves it, in which case result is the return value.
+func (s *state) evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, done bool, err error) {
+	if err := s.check(body); err != nil {
+		return nil, true, err
+	}
+	o, err := s.evalBlockStatement(body, env)
+	if err != nil {
+		return nil, true, err
+	}
+	switch o.Type() {
+	case object.ObjBreak:
+		return object.Null, true, nil
+	case object.ObjReturnValue:
+		return o, true, nil
+	default:
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"context"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/object"
+)
+
+// The functions below implement the operations of the language on values
+// that do not depend on how a program is executed. They are exported for the
+// virtual machine in package vm, so that it produces the same results and
+// errors as Eval. Infix, Prefix and Index are defined along with the
+// evaluation of the corresponding expressions.
+
+// IndexAssignable checks that the element of leftObj at indexObj can be set
+// by an assignment to target, and returns its current value: the element of
+// an array, or the value of a hash for the key, or null if there is none.
+func IndexAssignable(target *ast.IndexExpression, leftObj, indexObj object.Object) (object.Object, error) {
+	switch leftObj := leftObj.(type) {
+	case *object.Array:
+		i, ok := indexObj.(*object.Integer)
+		if !ok {
+			return nil, errorf(target.Index, "index must be integer; got %T", indexObj)
+		}
+		if i.Value < 0 || i.Value >= int64(len(leftObj.Elements)) {
+			return nil, errorf(target.Index, "index %v out of bound", i.Value)
+		}
+		return leftObj.Elements[i.Value], nil
+	case *object.Hash:
+		hashKey, ok := indexObj.(object.HashKeyer)
+		if !ok {
+			return nil, errorf(target.Index, "cannot get hash key from %v", indexObj)
+		}
+		if p, ok := leftObj.Hash[hashKey.HashKey()]; ok {
+			return p.V, nil
+		}
+		return object.Null, nil
+	default:
+		return nil, errorf(target, "index assignment on non array object %T", leftObj)
+	}
+}
+
+// SetIndex sets the element of leftObj at indexObj to o. The element must
+// have been checked by IndexAssignable.
+func SetIndex(leftObj, indexObj, o object.Object) {
+	switch leftObj := leftObj.(type) {
+	case *object.Array:
+		leftObj.Elements[indexObj.(*object.Integer).Value] = o
+	case *object.Hash:
+		leftObj.Set(indexObj, o)
+	}
+}
+
+// ForInItems returns the items a for-in loop iterates over: the elements of
+// an array, the characters of a string or the keys of a hash. The items are
+// collected up front so that the body of the loop can modify the iterable
+// without affecting the iteration.
+func ForInItems(node *ast.ForInStatement, iterable object.Object) ([]object.Object, error) {
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = append(items, iterable.Elements...)
+	case *object.String:
+		for _, ch := range iterable.Value {
+			items = append(items, &object.String{Value: string(ch)})
+		}
+	case *object.Hash:
+		for _, p := range iterable.Pairs {
+			items = append(items, p.K)
+		}
+	default:
+		return nil, errorf(node.Iterable, "cannot iterate over %T", iterable)
+	}
+	return items, nil
+}
+
+// LookupBuiltin returns the builtin function named name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	b, ok := builtins[name]
+	return b, ok
+}
+
+// CallBuiltin calls b with args for call in ctx, the context of the
+// evaluation, and reports its error at call.
+func CallBuiltin(ctx context.Context, call *ast.CallExpression, b *object.Builtin, args []object.Object) (object.Object, error) {
+	o, err := callBuiltin(ctx, b, args)
+	if err != nil {
+		return nil, errorf(call, "%v: %v", b.Name, err)
+	}
+	return o, nil
+}
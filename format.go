@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/wangkekekexili/mankey/format"
+)
+
+const fmtUsage = `Usage:
+	mankey fmt [flags] [paths...]
+
+Fmt formats mankey programs in the canonical style and writes them to the
+standard output. Directories are searched for .mk files. Without paths, the
+standard input is formatted.
+
+Flags:
+	-w   write the result to the file instead of the standard output
+	-l   list the files whose formatting differs from the canonical style
+	-d   print the diffs of formatting the files
+
+With -l or -d but not -w, the exit status is 1 if a file is not formatted.
+`
+
+func runFmt(arguments []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mankey fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, fmtUsage)
+	}
+	f := &formatter{stdout: stdout, stderr: stderr}
+	flags.BoolVar(&f.write, "w", false, "write the result to the file")
+	flags.BoolVar(&f.list, "l", false, "list the files whose formatting differs")
+	flags.BoolVar(&f.diff, "d", false, "print diffs")
+	if err := flags.Parse(arguments); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		if f.write {
+			fmt.Fprintln(stderr, "mankey fmt: cannot use -w with the standard input")
+			return exitUsage
+		}
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		f.format("<standard input>", string(src), 0)
+		return f.status
+	}
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			f.fail(err)
+			continue
+		}
+		if !info.IsDir() {
+			f.formatFile(path, info)
+			continue
+		}
+		filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				f.fail(err)
+			} else if !info.IsDir() && filepath.Ext(path) == ".mk" {
+				f.formatFile(path, info)
+			}
+			return nil
+		})
+	}
+	return f.status
+}
+
+// formatter formats files as told by the flags of mankey fmt.
+type formatter struct {
+	stdout, stderr io.Writer
+	write          bool
+	list           bool
+	diff           bool
+
+	status int // the exit status
+}
+
+func (f *formatter) fail(err error) {
+	fmt.Fprintln(f.stderr, err)
+	f.status = exitError
+}
+
+func (f *formatter) formatFile(filename string, info os.FileInfo) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	f.format(filename, string(src), info.Mode().Perm())
+}
+
+// format formats src, the contents of filename. perm is the permission of
+// the file to write with -w.
+func (f *formatter) format(filename, src string, perm os.FileMode) {
+	out, err := format.Source(filename, src)
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	if !f.write && !f.list && !f.diff {
+		fmt.Fprint(f.stdout, out)
+		return
+	}
+	if out == src {
+		return
+	}
+	if f.list {
+		fmt.Fprintln(f.stdout, filename)
+	}
+	if f.diff {
+		fmt.Fprint(f.stdout, format.Diff(filename, src, out))
+	}
+	if f.write {
+		if err := ioutil.WriteFile(filename, []byte(out), perm); err != nil {
+			f.fail(err)
+		}
+		return
+	}
+	f.status = exitError
+}
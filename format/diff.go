@@ -0,0 +1,169 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around the changes in a hunk.
+const diffContext = 3
+
+// Diff returns the changes from a to b, the contents of the file filename
+// before and after formatting, in the unified diff format. It returns an
+// empty string if a and b are the same.
+func Diff(filename, a, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	// aLines[i] and bLines[i] are the numbers of lines of a and b before
+	// edits[i].
+	aLines := make([]int, len(edits)+1)
+	bLines := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if e.op != '+' {
+			aLines[i+1]++
+		}
+		if e.op != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "--- %v.orig\n+++ %v\n", filename, filename)
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk over the changes separated by few unchanged lines.
+		end := i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = next
+		}
+		fmt.Fprintf(&s, "@@ -%v +%v @@\n",
+			hunkRange(aLines[start], aLines[end]), hunkRange(bLines[start], bLines[end]))
+		for _, e := range edits[start:end] {
+			s.WriteByte(e.op)
+			s.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				s.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return s.String()
+}
+
+// hunkRange formats the range of lines from start up to end of a hunk.
+func hunkRange(start, end int) string {
+	if start == end {
+		return fmt.Sprintf("%v,0", start)
+	}
+	return fmt.Sprintf("%v,%v", start+1, end-start)
+}
+
+// splitLines splits s after each newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edit is a line kept (' '), deleted ('-') or inserted ('+') by a diff.
+type edit struct {
+	op   byte
+	line string
+}
+
+// diffLines returns the shortest sequence of edits from a to b, found with
+// the algorithm of Myers.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] is the window of v that step d reads, the diagonals -d-1 to
+	// d+1, before the edits of the step, so that the trace takes O(d²)
+	// space.
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d] // v[d+1+k] is the value of diagonal k
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k] < v[d+k+2]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{' ', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{'+', b[prevY]})
+			} else {
+				edits = append(edits, edit{'-', a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
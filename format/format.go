@@ -0,0 +1,73 @@
+// Package format lays out mankey source code in the canonical style.
+//
+// The canonical style indents blocks with tabs, puts one statement per line
+// and separates operators, operands and list elements with single spaces.
+// Statements other than loops and if expressions end with a semicolon. A
+// block, array, hash or argument list written on one line stays on one line;
+// otherwise its statements or elements go on lines of their own. Comments
+// are kept where they appear, and single blank lines between statements are
+// kept. Formatting formatted code does not change it.
+package format
+
+import (
+	"strings"
+
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/parser"
+	"github.com/wangkekekexili/mankey/token"
+)
+
+// Source formats src, a whole program, reporting positions in filename. A
+// leading "#!" line is kept as it is. The error, if any, is a
+// parser.ErrorList of the syntax errors in src.
+func Source(filename, src string) (string, error) {
+	r := lexer.NewFile(filename, src)
+	r.SetMode(lexer.SkipShebang)
+	program, err := parser.New(r).ParseProgram()
+	if err != nil {
+		return "", err
+	}
+	p := &printer{src: src, comments: comments(src)}
+	p.shebang()
+	p.statements(program.Statements, len(src))
+	p.flushComments(len(src))
+	out := strings.TrimRight(p.b.String(), "\n")
+	if out == "" {
+		return "", nil
+	}
+	return out + "\n", nil
+}
+
+// shebang prints the leading "#!" line of the source as it is, followed by a
+// blank line if there is one after it.
+func (p *printer) shebang() {
+	if !strings.HasPrefix(p.src, "#!") {
+		return
+	}
+	line, rest := p.src, ""
+	if i := strings.IndexByte(p.src, '\n'); i >= 0 {
+		line, rest = p.src[:i], p.src[i:]
+	}
+	p.write(line)
+	p.newline()
+	space := rest[:len(rest)-len(strings.TrimLeft(rest, " \t\r\n"))]
+	if len(space) < len(rest) && strings.Count(space, "\n") > 1 {
+		p.newline()
+	}
+}
+
+// comments returns the comments in src, in source order.
+func comments(src string) []*token.Token {
+	r := lexer.New(src)
+	r.SetMode(lexer.ScanComments | lexer.SkipShebang)
+	var list []*token.Token
+	for {
+		t := r.NextToken()
+		switch t.Type {
+		case token.EOF:
+			return list
+		case token.Comment:
+			list = append(list, t)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package format
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/parser"
+)
+
+var formatTests = []struct {
+	input, expected string
+}{
+	{"", ""},
+	{"  \n\n", ""},
+	{"var   x=1+2*3", "var x = 1 + 2 * 3;\n"},
+	{"(1 + 2) * 3; 1 + (2 * 3); 1 - (2 - 3); (1 - 2) - 3", "(1 + 2) * 3;\n1 + 2 * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+	{"a || b && c; (a || b) && c", "a || b && c;\n(a || b) && c;\n"},
+	{"-(-x); !(a == b); -a * b; -(a * b)", "-(-x);\n!(a == b);\n-a * b;\n-(a * b);\n"},
+	{"(-a)[0]; -a[0]; (a + b)(1); f(1)[2]; a[1](2)", "(-a)[0];\n-a[0];\n(a + b)(1);\nf(1)[2];\na[1](2);\n"},
+	{"x+=1;a[0]*=2", "x += 1;\na[0] *= 2;\n"},
+	{`"a\tb"; 1.50; 1e3; ` + "`raw\nstring`", "\"a\\tb\";\n1.50;\n1e3;\n`raw\nstring`;\n"},
+	{`{"b":1,"a":[1,2]}; {}; []`, "{\"b\": 1, \"a\": [1, 2]};\n{};\n[];\n"},
+	{"f( 1,2 ); g()", "f(1, 2);\ng();\n"},
+	{"var f = func ( a,b ) { a+b }", "var f = func(a, b) { a + b };\n"},
+	{"var f = func() {\nreturn 1\n}", "var f = func() {\n\treturn 1;\n};\n"},
+	{"if(x){1}else{2}", "if (x) { 1 } else { 2 }\n"},
+	{"if (x) {\n1\n} else {\n2\n}\ny", "if (x) {\n\t1;\n} else {\n\t2;\n}\ny;\n"},
+	{"if (x) { 1 }; (y)", "if (x) { 1 }\ny;\n"},
+	{"if (x) { 1 }; (a + b) * 2", "if (x) { 1 };\n(a + b) * 2;\n"},
+	{"if (x) { 1 }; -y", "if (x) { 1 };\n-y;\n"},
+	{"if (x) { 1 }; [y]", "if (x) { 1 };\n[y];\n"},
+	{"if (x) { 1 }; !y", "if (x) { 1 }\n!y;\n"},
+	{"if (x) {}", "if (x) {}\n"},
+	{"while(true){break;}", "while (true) { break }\n"},
+	{"while (x) {\nif (y) { continue; }\nx = false;\n}", "while (x) {\n\tif (y) { continue }\n\tx = false;\n}\n"},
+	{"for(var i=0;i<3;i+=1){}", "for (var i = 0; i < 3; i += 1) {}\n"},
+	{"for(;;){break}; for (;x;) {break}", "for (;;) { break }\nfor (; x;) { break }\n"},
+	{"for(k in h){\nputs(k)\n}", "for (k in h) {\n\tputs(k);\n}\n"},
+	{"var a = [\n1,\n2]", "var a = [\n\t1,\n\t2\n];\n"},
+	{"var h = {\n\"a\": 1, \"b\": 2}", "var h = {\n\t\"a\": 1,\n\t\"b\": 2\n};\n"},
+	{"f(\n1, 2)", "f(\n\t1,\n\t2\n);\n"},
+	{"f(func(x) {\nx\n})", "f(func(x) {\n\tx;\n});\n"},
+	// Blank lines.
+	{"a\n\n\n\nb\nc", "a;\n\nb;\nc;\n"},
+	{"var f = func() {\n\n1\n\n}", "var f = func() {\n\t1;\n};\n"},
+	// Comments.
+	{"// a\nx // b\n/* c */ y", "// a\nx; // b\n/* c */\ny;\n"},
+	{"x\n\n// a\n\n// b\ny", "x;\n\n// a\n\n// b\ny;\n"},
+	{"var f = func() { 1 /* a */ }", "var f = func() {\n\t1; /* a */\n};\n"},
+	{"var f = func() { // a\n}", "var f = func() {\n\t// a\n};\n"},
+	{"while (x) {\n\tx = false\n\t// a\n}\n// b", "while (x) {\n\tx = false;\n\t// a\n}\n// b\n"},
+	{"[1, 2 // a\n]", "[\n\t1,\n\t2 // a\n];\n"},
+	{"f(1, // a\n2)", "f(\n\t1, // a\n\t2\n);\n"},
+	{"x /* a */ + 1", "x /* a */ + 1;\n"},
+	{"x + /* a */ 1", "x + /* a */ 1;\n"},
+	{"(a + b) /* a */ * (c /* c */ - d)", "(a + b) /* a */ * (c /* c */ - d);\n"},
+	{"x // a\n+ 1", "x // a\n+ 1;\n"},
+	{"x /*/ a */ + 1", "x /*/ a */ + 1;\n"},
+	{"var x = // a\n1", "var x = // a\n1;\n"},
+	{"x // a  \r\n", "x; // a\n"},
+	// Comments between the header of a statement and its block.
+	{"if (x) /* c */ { 1 }", "if (x) /* c */ { 1 }\n"},
+	{"if (x) { 1 } else /* c */ { 2 }", "if (x) { 1 } else /* c */ { 2 }\n"},
+	{"var f = func() /* c */ { 1 }", "var f = func() /* c */ { 1 };\n"},
+	{"while (x > 0) /* w */ { x -= 1 }", "while (x > 0) /* w */ { x -= 1 }\n"},
+	{"for (k in h) /* c */ { k }", "for (k in h) /* c */ { k }\n"},
+	{"for (;;) /* c */ {\nbreak\n}", "for (;;) /* c */ {\n\tbreak;\n}\n"},
+	{"if (x) // c\n{ 1 }", "if (x) // c\n{ 1 }\n"},
+	// The "#!" line of a script is kept as it is.
+	{"#!/usr/bin/env  mankey ", "#!/usr/bin/env  mankey \n"},
+	{"#!/usr/bin/env mankey\nx=1", "#!/usr/bin/env mankey\nx = 1;\n"},
+	{"#!/usr/bin/env mankey\n\n\n// a\nx\n", "#!/usr/bin/env mankey\n\n// a\nx;\n"},
+}
+
+func TestSource(t *testing.T) {
+	for _, test := range formatTests {
+		got, err := Source("", test.input)
+		if err != nil {
+			t.Errorf("Source(%q): %v", test.input, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("Source(%q):\nexpect\n%v\ngot\n%v", test.input, test.expected, got)
+		}
+	}
+}
+
+// TestSourceProperties checks that formatting is idempotent, that it keeps
+// the comments, and that the formatted source parses to the same tree.
+func TestSourceProperties(t *testing.T) {
+	for _, test := range formatTests {
+		got, err := Source("", test.input)
+		if err != nil {
+			continue
+		}
+		again, err := Source("", got)
+		if err != nil {
+			t.Errorf("Source(%q) returned %q, which does not parse: %v", test.input, got, err)
+			continue
+		}
+		if again != got {
+			t.Errorf("Source(%q) is not idempotent:\n%v\nthen\n%v", test.input, got, again)
+		}
+		if n, m := len(comments(test.input)), len(comments(got)); n != m {
+			t.Errorf("Source(%q) has %v comments; expect %v", test.input, m, n)
+		}
+		want := parse(t, test.input)
+		if tree := parse(t, got); tree != want {
+			t.Errorf("Source(%q) changed the tree from %v to %v", test.input, want, tree)
+		}
+	}
+}
+
+func parse(t *testing.T, src string) string {
+	r := lexer.New(src)
+	r.SetMode(lexer.SkipShebang)
+	program, err := parser.New(r).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	return program.String()
+}
+
+func TestSourceError(t *testing.T) {
+	_, err := Source("a.mk", "var = 1")
+	if _, ok := err.(parser.ErrorList); !ok {
+		t.Fatalf("expect a parser.ErrorList; got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "a.mk:1:5: ") {
+		t.Errorf("expect the error at a.mk:1:5; got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b, expected string
+	}{
+		{"a\n", "a\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- f.orig\n+++ f\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\n", "--- f.orig\n+++ f\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"a", "a\n", "--- f.orig\n+++ f\n@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"--- f.orig\n+++ f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n",
+			"0\n1\n2\n3\n4\n5\n",
+			"--- f.orig\n+++ f\n@@ -1,6 +1,6 @@\n+0\n 1\n 2\n 3\n 4\n 5\n-6\n",
+		},
+	}
+	for _, test := range tests {
+		if got := Diff("f", test.a, test.b); got != test.expected {
+			t.Errorf("Diff(%q, %q):\nexpect\n%v\ngot\n%v", test.a, test.b, test.expected, got)
+		}
+	}
+}
+
+// TestDiffLines checks that the edits of random changes turn a into b.
+func TestDiffLines(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lines := func(n int) []string {
+		l := make([]string, n)
+		for i := range l {
+			l[i] = string('a'+rune(rnd.Intn(4))) + "\n"
+		}
+		return l
+	}
+	for i := 0; i < 100; i++ {
+		a, b := lines(rnd.Intn(50)), lines(rnd.Intn(50))
+		var gotA, gotB []string
+		for _, e := range diffLines(a, b) {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) does not turn the first into the second", a, b)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/token"
+)
+
+// printer writes a tree in the canonical style, along with the comments of
+// its source. Comments are printed before the first node that follows them,
+// or at the end of the line of the statement or element they follow.
+type printer struct {
+	src      string
+	comments []*token.Token // the comments not printed yet
+
+	b         strings.Builder
+	indent    int
+	lineStart bool // nothing has been written on the current line
+	line      int  // source line of the last statement or comment printed, or 0 at the start of a list
+}
+
+func (p *printer) write(s string) {
+	if p.lineStart {
+		p.b.WriteString(strings.Repeat("\t", p.indent))
+		p.lineStart = false
+	}
+	p.b.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.b.WriteByte('\n')
+	p.lineStart = true
+}
+
+// blankLine writes an empty line if there is one in the source between the
+// last statement or comment printed and line.
+func (p *printer) blankLine(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.newline()
+	}
+}
+
+// nextComment returns the next comment to print if it starts before offset.
+func (p *printer) nextComment(offset int) *token.Token {
+	if len(p.comments) == 0 || p.comments[0].Pos.Offset >= offset {
+		return nil
+	}
+	return p.comments[0]
+}
+
+func isLineComment(c *token.Token) bool {
+	return strings.HasPrefix(c.Literal, "//")
+}
+
+func commentText(c *token.Token) string {
+	if isLineComment(c) {
+		return strings.TrimRight(c.Literal, " \t\r")
+	}
+	return c.Literal
+}
+
+// flushComments prints the comments before offset on lines of their own.
+func (p *printer) flushComments(offset int) {
+	for c := p.nextComment(offset); c != nil; c = p.nextComment(offset) {
+		p.comments = p.comments[1:]
+		p.blankLine(c.Pos.Line)
+		p.write(commentText(c))
+		p.newline()
+		p.line = c.End.Line
+	}
+}
+
+// inlineComments prints the comments before offset in the middle of a line.
+// A line comment ends the line.
+func (p *printer) inlineComments(offset int) {
+	for c := p.nextComment(offset); c != nil; c = p.nextComment(offset) {
+		p.comments = p.comments[1:]
+		p.write(commentText(c))
+		if isLineComment(c) {
+			p.newline()
+		} else {
+			p.write(" ")
+		}
+	}
+}
+
+// operandComments prints the comments before offset after the operand just
+// printed. A line comment ends the line.
+func (p *printer) operandComments(offset int) {
+	for c := p.nextComment(offset); c != nil; c = p.nextComment(offset) {
+		p.comments = p.comments[1:]
+		p.write(" " + commentText(c))
+		if isLineComment(c) {
+			p.newline()
+		}
+	}
+}
+
+// operatorOffset returns the offset of the operator that follows an operand
+// ending at offset, after any closing parentheses and comments.
+func (p *printer) operatorOffset(offset int) int {
+	for offset < len(p.src) {
+		switch rest := p.src[offset:]; {
+		case strings.HasPrefix(rest, "//"):
+			offset += strings.IndexByte(rest+"\n", '\n')
+		case strings.HasPrefix(rest, "/*"):
+			offset += len("/*") + strings.Index(rest[len("/*"):]+"*/", "*/") + len("*/")
+		case strings.IndexByte(" \t\r\n)", rest[0]) >= 0:
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// trailingComments prints the comments on the source line line before
+// offset at the end of the current line.
+func (p *printer) trailingComments(line, offset int) {
+	for c := p.nextComment(offset); c != nil && c.Pos.Line == line; c = p.nextComment(offset) {
+		p.comments = p.comments[1:]
+		p.write(" " + commentText(c))
+		p.line = c.End.Line
+	}
+}
+
+// hasComments tells whether there are comments to print between the offsets
+// from and to. If lineOnly is set, only line comments are considered.
+func (p *printer) hasComments(from, to int, lineOnly bool) bool {
+	for _, c := range p.comments {
+		if c.Pos.Offset >= to {
+			break
+		}
+		if c.Pos.Offset >= from && (!lineOnly || isLineComment(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// statements prints stats on lines of their own, followed by the comments
+// before offset end.
+func (p *printer) statements(stats []ast.Statement, end int) {
+	p.line = 0
+	for i, stat := range stats {
+		p.flushComments(stat.Pos().Offset)
+		p.blankLine(stat.Pos().Line)
+		p.statement(stat)
+		next := end
+		if i+1 < len(stats) {
+			next = stats[i+1].Pos().Offset
+		}
+		if needsSemicolon(stat, stats[i+1:]) {
+			p.write(";")
+		}
+		p.line = stat.End().Line
+		p.trailingComments(p.line, next)
+		p.newline()
+	}
+	p.flushComments(end)
+}
+
+// needsSemicolon tells whether stat, followed by rest, ends with a
+// semicolon. An if expression only needs one if the next statement would
+// otherwise continue it.
+func needsSemicolon(stat ast.Statement, rest []ast.Statement) bool {
+	switch stat := stat.(type) {
+	case *ast.WhileStatement, *ast.ForStatement, *ast.ForInStatement:
+		return false
+	case *ast.ExpressionStatement:
+		if _, ok := stat.Value.(*ast.IfExpression); ok {
+			return len(rest) > 0 && startsWithOperator(rest[0])
+		}
+	}
+	return true
+}
+
+// startsWithOperator tells whether stat starts with a token that can follow
+// an expression as an operator.
+func startsWithOperator(stat ast.Statement) bool {
+	var expr ast.Expression
+	switch stat := stat.(type) {
+	case *ast.ExpressionStatement:
+		expr = stat.Value
+	case *ast.AssignStatement:
+		expr = stat.Target
+	default:
+		return false
+	}
+	for {
+		switch n := expr.(type) {
+		case *ast.Array:
+			return true
+		case *ast.PrefixExpression:
+			return n.Op == "-"
+		case *ast.InfixExpression:
+			if leftNeedsParens(n) {
+				return true
+			}
+			expr = n.Left
+		case *ast.CallExpression:
+			if isOperation(n.Function) {
+				return true
+			}
+			expr = n.Function
+		case *ast.IndexExpression:
+			if isOperation(n.Left) {
+				return true
+			}
+			expr = n.Left
+		default:
+			return false
+		}
+	}
+}
+
+func (p *printer) statement(stat ast.Statement) {
+	switch n := stat.(type) {
+	case *ast.VarStatement:
+		p.write("var ")
+		p.expr(n.Name)
+		p.write(" = ")
+		p.expr(n.Value)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expr(n.Value)
+	case *ast.AssignStatement:
+		p.expr(n.Target)
+		p.write(" " + string(n.Op) + " ")
+		p.expr(n.Value)
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expr(n.Condition)
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.ForStatement:
+		p.write("for (")
+		if n.Init != nil {
+			p.statement(n.Init)
+		}
+		p.write(";")
+		if n.Condition != nil {
+			p.write(" ")
+			p.expr(n.Condition)
+		}
+		p.write(";")
+		if n.Post != nil {
+			p.write(" ")
+			p.statement(n.Post)
+		}
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.ForInStatement:
+		p.write("for (")
+		p.expr(n.Variable)
+		p.write(" in ")
+		p.expr(n.Iterable)
+		p.write(") ")
+		p.block(n.Body)
+	case *ast.BreakStatement:
+		p.write("break")
+	case *ast.ContinueStatement:
+		p.write("continue")
+	case *ast.ExpressionStatement:
+		p.expr(n.Value)
+	}
+}
+
+// block prints a block on one line if it is on one line in the source and
+// has no comments, or else with its statements on lines of their own. The
+// comments before the block, after the header of its statement, are printed
+// before the opening brace.
+func (p *printer) block(b *ast.BlockStatement) {
+	p.inlineComments(b.Pos().Offset)
+	closing := b.End().Offset - 1
+	if !p.hasComments(b.Pos().Offset, closing, false) {
+		if len(b.Statements) == 0 {
+			p.write("{}")
+			return
+		}
+		if b.Pos().Line == b.End().Line {
+			p.write("{ ")
+			for i, stat := range b.Statements {
+				if i > 0 {
+					p.write("; ")
+				}
+				p.statement(stat)
+			}
+			p.write(" }")
+			return
+		}
+	}
+	p.write("{")
+	p.indent++
+	p.newline()
+	p.statements(b.Statements, closing)
+	p.indent--
+	p.write("}")
+}
+
+// The precedences of the binary operators, which are left associative.
+var precedences = map[ast.Operator]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6,
+}
+
+// isOperation tells whether expr is an operator expression, which needs
+// parentheses as the operand of a prefix operator, a call or an index.
+func isOperation(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.PrefixExpression, *ast.InfixExpression:
+		return true
+	}
+	return false
+}
+
+func leftNeedsParens(n *ast.InfixExpression) bool {
+	left, ok := n.Left.(*ast.InfixExpression)
+	return ok && precedences[left.Op] < precedences[n.Op]
+}
+
+func rightNeedsParens(n *ast.InfixExpression) bool {
+	right, ok := n.Right.(*ast.InfixExpression)
+	return ok && precedences[right.Op] <= precedences[n.Op]
+}
+
+// operand prints expr, in parentheses if parens is set.
+func (p *printer) operand(expr ast.Expression, parens bool) {
+	if !parens {
+		p.expr(expr)
+		return
+	}
+	p.inlineComments(expr.Pos().Offset)
+	p.write("(")
+	p.expr(expr)
+	p.write(")")
+}
+
+func (p *printer) expr(expr ast.Expression) {
+	p.inlineComments(expr.Pos().Offset)
+	switch n := expr.(type) {
+	case *ast.Identifier:
+		p.write(n.Value)
+	case *ast.Integer, *ast.Float, *ast.String:
+		p.write(p.src[n.Pos().Offset:n.End().Offset])
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(n.Value))
+	case *ast.Array:
+		p.list("[", "]", n.Pos().Line, n.End().Offset-1, len(n.Elements),
+			func(i int) ast.Node { return n.Elements[i] },
+			func(i int) ast.Node { return n.Elements[i] },
+			func(i int) { p.expr(n.Elements[i]) })
+	case *ast.Hash:
+		p.list("{", "}", n.Pos().Line, n.End().Offset-1, len(n.Pairs),
+			func(i int) ast.Node { return n.Pairs[i].Key },
+			func(i int) ast.Node { return n.Pairs[i].Value },
+			func(i int) {
+				p.expr(n.Pairs[i].Key)
+				p.write(": ")
+				p.expr(n.Pairs[i].Value)
+			})
+	case *ast.IndexExpression:
+		p.operand(n.Left, isOperation(n.Left))
+		p.write("[")
+		p.expr(n.Index)
+		p.write("]")
+	case *ast.CallExpression:
+		p.operand(n.Function, isOperation(n.Function))
+		p.list("(", ")", n.Function.End().Line, n.End().Offset-1, len(n.Arguments),
+			func(i int) ast.Node { return n.Arguments[i] },
+			func(i int) ast.Node { return n.Arguments[i] },
+			func(i int) { p.expr(n.Arguments[i]) })
+	case *ast.PrefixExpression:
+		p.write(string(n.Op))
+		p.operand(n.Value, isOperation(n.Value))
+	case *ast.InfixExpression:
+		// The comments before the operator stay after the left operand.
+		p.operand(n.Left, leftNeedsParens(n))
+		p.operandComments(p.operatorOffset(n.Left.End().Offset))
+		if !p.lineStart {
+			p.write(" ")
+		}
+		p.write(string(n.Op) + " ")
+		p.operand(n.Right, rightNeedsParens(n))
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expr(n.Condition)
+		p.write(") ")
+		p.block(n.Consequence)
+		if n.Alternative != nil {
+			p.write(" else ")
+			p.block(n.Alternative)
+		}
+	case *ast.Function:
+		p.write("func(")
+		for i, para := range n.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(para)
+		}
+		p.write(") ")
+		p.block(n.Body)
+	}
+}
+
+// list prints the n elements of a list between open and close. The list
+// opens on source line line and closes at offset closing. first and last
+// return the first and last nodes of an element, and print prints it. The
+// elements are printed on one line, unless the first one is on a later line
+// than the opening in the source or there are line comments in the list.
+func (p *printer) list(open, close string, line, closing, n int, first, last func(i int) ast.Node, print func(i int)) {
+	if n == 0 || (first(0).Pos().Line == line && !p.hasComments(first(0).Pos().Offset, closing, true)) {
+		p.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			print(i)
+		}
+		p.write(close)
+		return
+	}
+	p.write(open)
+	p.indent++
+	p.newline()
+	for i := 0; i < n; i++ {
+		p.line = 0
+		p.flushComments(first(i).Pos().Offset)
+		print(i)
+		next := closing
+		if i+1 < n {
+			p.write(",")
+			next = first(i + 1).Pos().Offset
+		}
+		p.trailingComments(last(i).End().Line, next)
+		p.newline()
+	}
+	p.line = 0
+	p.flushComments(closing)
+	p.indent--
+	p.write(close)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	formatted   = "var x = 1;\n"
+	unformatted = "var x=1"
+	broken      = "var = 1"
+)
+
+// fmtDir creates a directory with files of the given contents, named by
+// their paths relative to it.
+func fmtDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "mankey-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// mankeyFmt runs mankey fmt with arguments, and src as the standard input.
+func mankeyFmt(src string, arguments ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = runFmt(arguments, strings.NewReader(src), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestFmtStdin(t *testing.T) {
+	tests := []struct {
+		src       string
+		arguments []string
+		code      int
+		stdout    string
+		stderr    string // a prefix of the standard error
+	}{
+		{unformatted, nil, exitOK, formatted, ""},
+		{formatted, []string{"-l"}, exitOK, "", ""},
+		{unformatted, []string{"-l"}, exitError, "<standard input>\n", ""},
+		{unformatted, []string{"-d"}, exitError, "--- <standard input>.orig\n+++ <standard input>\n@@ -1,1 +1,1 @@\n-var x=1\n\\ No newline at end of file\n+var x = 1;\n", ""},
+		{broken, nil, exitError, "", "<standard input>:1:5: "},
+		{unformatted, []string{"-w"}, exitUsage, "", "mankey fmt: cannot use -w with the standard input\n"},
+		{unformatted, []string{"-unknown"}, exitUsage, "", "flag provided but not defined: -unknown\n"},
+		{unformatted, []string{"-h"}, exitOK, "", "Usage:"},
+	}
+	for _, test := range tests {
+		code, stdout, stderr := mankeyFmt(test.src, test.arguments...)
+		if code != test.code || stdout != test.stdout || !strings.HasPrefix(stderr, test.stderr) || (test.stderr == "" && stderr != "") {
+			t.Errorf("mankey fmt %q with %q: got %v, stdout %q, stderr %q; want %v, stdout %q, stderr %q...",
+				test.arguments, test.src, code, stdout, stderr, test.code, test.stdout, test.stderr)
+		}
+	}
+}
+
+func TestFmtFiles(t *testing.T) {
+	dir := fmtDir(t, map[string]string{
+		"good.mk":       formatted,
+		"bad.mk":        unformatted,
+		"sub/bad.mk":    unformatted,
+		"sub/notes.txt": unformatted,
+	})
+	defer os.RemoveAll(dir)
+	good, bad, subBad := filepath.Join(dir, "good.mk"), filepath.Join(dir, "bad.mk"), filepath.Join(dir, "sub", "bad.mk")
+
+	// Without flags, the files are formatted to the standard output.
+	code, stdout, stderr := mankeyFmt("", good, bad)
+	if code != exitOK || stdout != formatted+formatted || stderr != "" {
+		t.Errorf("mankey fmt: got %v, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	// -l lists the files to format in directories, but not the other files.
+	code, stdout, stderr = mankeyFmt("", "-l", dir)
+	if want := bad + "\n" + subBad + "\n"; code != exitError || stdout != want || stderr != "" {
+		t.Errorf("mankey fmt -l: got %v, stdout %q, stderr %q; want %v, stdout %q", code, stdout, stderr, exitError, want)
+	}
+	code, stdout, stderr = mankeyFmt("", "-l", good)
+	if code != exitOK || stdout != "" || stderr != "" {
+		t.Errorf("mankey fmt -l: got %v, stdout %q, stderr %q; want %v", code, stdout, stderr, exitOK)
+	}
+
+	// -d prints the diffs without changing the files.
+	code, stdout, stderr = mankeyFmt("", "-d", good, bad)
+	if want := "--- " + bad + ".orig\n"; code != exitError || !strings.HasPrefix(stdout, want) || stderr != "" {
+		t.Errorf("mankey fmt -d: got %v, stdout %q, stderr %q; want %v, stdout %q...", code, stdout, stderr, exitError, want)
+	}
+	if src, err := ioutil.ReadFile(bad); err != nil || string(src) != unformatted {
+		t.Errorf("mankey fmt -d changed %v to %q, %v", bad, src, err)
+	}
+
+	// -w rewrites the files, keeping their permissions, and succeeds.
+	code, stdout, stderr = mankeyFmt("", "-w", "-l", dir)
+	if want := bad + "\n" + subBad + "\n"; code != exitOK || stdout != want || stderr != "" {
+		t.Errorf("mankey fmt -w -l: got %v, stdout %q, stderr %q; want %v, stdout %q", code, stdout, stderr, exitOK, want)
+	}
+	for _, path := range []string{bad, subBad} {
+		src, err := ioutil.ReadFile(path)
+		if err != nil || string(src) != formatted {
+			t.Errorf("mankey fmt -w wrote %q, %v to %v; want %q", src, err, path, formatted)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("mankey fmt -w changed the permissions of %v to %v, %v", path, info.Mode().Perm(), err)
+		}
+	}
+	if src, err := ioutil.ReadFile(filepath.Join(dir, "sub", "notes.txt")); err != nil || string(src) != unformatted {
+		t.Errorf("mankey fmt -w changed notes.txt to %q, %v", src, err)
+	}
+	code, stdout, stderr = mankeyFmt("", "-l", dir)
+	if code != exitOK || stdout != "" || stderr != "" {
+		t.Errorf("mankey fmt -l after -w: got %v, stdout %q, stderr %q; want %v", code, stdout, stderr, exitOK)
+	}
+}
+
+func TestFmtErrors(t *testing.T) {
+	dir := fmtDir(t, map[string]string{"good.mk": formatted, "broken.mk": broken})
+	defer os.RemoveAll(dir)
+	good, brokenFile := filepath.Join(dir, "good.mk"), filepath.Join(dir, "broken.mk")
+
+	// A file that does not parse is reported, and the other files are still
+	// formatted.
+	for _, flag := range []string{"-l", "-d", "-w"} {
+		code, stdout, stderr := mankeyFmt("", flag, brokenFile, good)
+		if want := brokenFile + ":1:5: "; code != exitError || stdout != "" || !strings.HasPrefix(stderr, want) {
+			t.Errorf("mankey fmt %v: got %v, stdout %q, stderr %q; want %v, stderr %q...", flag, code, stdout, stderr, exitError, want)
+		}
+	}
+	if src, err := ioutil.ReadFile(brokenFile); err != nil || string(src) != broken {
+		t.Errorf("mankey fmt -w changed %v to %q, %v", brokenFile, src, err)
+	}
+
+	code, stdout, stderr := mankeyFmt("", filepath.Join(dir, "missing.mk"))
+	if code != exitError || stdout != "" || !strings.Contains(stderr, "missing.mk") {
+		t.Errorf("mankey fmt of a missing file: got %v, stdout %q, stderr %q; want %v", code, stdout, stderr, exitError)
+	}
+}
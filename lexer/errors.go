@@ -0,0 +1,43 @@
+package lexer
+
+import (
+	"fmt"
+
+	"github.com/wangkekekexili/mankey/token"
+)
+
+// ErrorKind classifies a lexical error.
+type ErrorKind int
+
+const (
+	InvalidEscape ErrorKind = iota + 1
+	UnterminatedString
+	UnterminatedComment
+	InvalidCharacter
+	InvalidNumber
+)
+
+// Error is a lexical error. The lexer records it and carries on scanning, so
+// malformed input never makes it panic.
+type Error struct {
+	Kind ErrorKind
+	Pos  token.Position
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// Errors returns the errors found in the tokens scanned so far.
+func (r *Lexer) Errors() []*Error {
+	return r.errors
+}
+
+func (r *Lexer) errorf(kind ErrorKind, offset int, format string, a ...interface{}) {
+	r.errors = append(r.errors, &Error{
+		Kind: kind,
+		Pos:  r.position(offset),
+		Msg:  fmt.Sprintf(format, a...),
+	})
+}
@@ -1,18 +1,76 @@
 package lexer
 
 import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/wangkekekexili/mankey/token"
 )
 
+// Mode controls optional lexer behavior.
+type Mode uint
+
+const (
+	// ScanComments makes NextToken return comments as Comment tokens
+	// instead of skipping them.
+	ScanComments Mode = 1 << iota
+
+	// SkipShebang makes the lexer skip a leading "#!" line, which allows
+	// script files to be executed directly on Unix. It must be set before
+	// the first call to NextToken.
+	SkipShebang
+)
+
 type Lexer struct {
-	input string
-	pos   int // last checked position
+	filename string
+	input    string
+	pos      int   // last checked position
+	lines    []int // offsets of the first character of each line
+	mode     Mode
+	errors   []*Error
 }
 
 func New(input string) *Lexer {
+	return NewFile("", input)
+}
+
+// NewFile returns a lexer for input whose token positions report filename.
+func NewFile(filename, input string) *Lexer {
+	lines := []int{0}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
 	return &Lexer{
-		input: input,
-		pos:   -1,
+		filename: filename,
+		input:    input,
+		pos:      -1,
+		lines:    lines,
+	}
+}
+
+// SetMode changes the behavior of subsequent calls to NextToken.
+func (r *Lexer) SetMode(m Mode) {
+	r.mode = m
+	if m&SkipShebang != 0 && r.pos < 0 && strings.HasPrefix(r.input, "#!") {
+		end := strings.IndexByte(r.input, '\n')
+		if end < 0 {
+			end = len(r.input)
+		}
+		r.pos = end - 1
+	}
+}
+
+// position converts a byte offset in the input into a token.Position.
+func (r *Lexer) position(offset int) token.Position {
+	line := sort.Search(len(r.lines), func(i int) bool { return r.lines[i] > offset }) - 1
+	return token.Position{
+		Filename: r.filename,
+		Offset:   offset,
+		Line:     line + 1,
+		Column:   offset - r.lines[line] + 1,
 	}
 }
 
@@ -24,14 +82,6 @@ func (r *Lexer) currentChar() (byte, bool) {
 	}
 }
 
-func (r *Lexer) mustCurrentChar() byte {
-	b, ok := r.currentChar()
-	if !ok {
-		panic("failed to get current char")
-	}
-	return b
-}
-
 func (r *Lexer) nextChar() (byte, bool) {
 	next := r.pos + 1
 	if next >= len(r.input) {
@@ -49,6 +99,14 @@ func (r *Lexer) peekNextChar() (byte, bool) {
 	return r.input[next], true
 }
 
+func (r *Lexer) peekSecondChar() (byte, bool) {
+	next := r.pos + 2
+	if next >= len(r.input) {
+		return 0, false
+	}
+	return r.input[next], true
+}
+
 func (r *Lexer) advance() {
 	if r.pos < len(r.input) {
 		r.pos++
@@ -87,22 +145,121 @@ func (r *Lexer) mustCurrentNumber() string {
 	}
 }
 
+// mustCurrentString returns the value of the string literal starting at the
+// current double quote, with escape sequences replaced.
 func (r *Lexer) mustCurrentString() string {
-	// start points to the starting quote.
 	start := r.pos
-
+	var b strings.Builder
 	for {
 		r.advance()
 		ch, ok := r.currentChar()
 		if !ok {
-			panic("unfinishing string")
+			r.unterminatedString(start)
+			return b.String()
+		}
+		switch ch {
+		case '"':
+			return b.String()
+		case '\\':
+			r.mustEscape(&b)
+		default:
+			b.WriteByte(ch)
 		}
-		if ch == '"' {
+	}
+}
+
+var simpleEscapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// mustEscape writes the character denoted by the escape sequence starting at
+// the current backslash to b. Invalid escape sequences are reported as
+// errors and written as they are.
+func (r *Lexer) mustEscape(b *strings.Builder) {
+	start := r.pos
+	r.advance()
+	ch, ok := r.currentChar()
+	if !ok {
+		// The caller reports the unterminated string.
+		return
+	}
+	if c, ok := simpleEscapes[ch]; ok {
+		b.WriteByte(c)
+		return
+	}
+	switch ch {
+	case 'x':
+		if v, ok := r.hexDigits(2, 2); ok {
+			b.WriteByte(byte(v))
+			return
+		}
+	case 'u':
+		if n, _ := r.peekNextChar(); n == '{' {
+			r.advance()
+			v, ok := r.hexDigits(1, 6)
+			if n, _ := r.peekNextChar(); ok && n == '}' {
+				r.advance()
+				if utf8.ValidRune(rune(v)) {
+					b.WriteRune(rune(v))
+					return
+				}
+			}
+		}
+	}
+	seq := r.input[start : r.pos+1]
+	r.errorf(InvalidEscape, start, "invalid escape sequence %q", seq)
+	b.WriteString(seq)
+}
+
+// hexDigits consumes between min and max hexadecimal digits following the
+// current position and returns their value.
+func (r *Lexer) hexDigits(min, max int) (int, bool) {
+	v, n := 0, 0
+	for n < max {
+		ch, ok := r.peekNextChar()
+		if !ok {
+			break
+		}
+		d, ok := hexValue(ch)
+		if !ok {
 			break
 		}
+		r.advance()
+		v = v*16 + d
+		n++
 	}
+	return v, n >= min
+}
 
-	return r.input[start+1 : r.pos]
+// mustCurrentRawString returns the value of the raw string literal starting
+// at the current backquote. Raw strings may span multiple lines and have no
+// escape sequences.
+func (r *Lexer) mustCurrentRawString() string {
+	start := r.pos
+	for {
+		r.advance()
+		ch, ok := r.currentChar()
+		if !ok {
+			r.unterminatedString(start)
+			return r.input[start+1:]
+		}
+		if ch == '`' {
+			return r.input[start+1 : r.pos]
+		}
+	}
+}
+
+// unterminatedString reports a string literal starting at offset start which
+// is not closed before the end of the input.
+func (r *Lexer) unterminatedString(start int) {
+	r.pos = len(r.input) - 1
+	r.errorf(UnterminatedString, start, "unterminated string")
 }
 
 func (r *Lexer) skipWhitespace() {
@@ -111,7 +268,7 @@ func (r *Lexer) skipWhitespace() {
 		if !ok {
 			return
 		}
-		if b == ' ' || b == '\t' || b == '\n' {
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
 			r.advance()
 			continue
 		} else {
@@ -120,8 +277,61 @@ func (r *Lexer) skipWhitespace() {
 	}
 }
 
+// mustCurrentLineComment returns the comment starting at the current "//"
+// up to the end of the line.
+func (r *Lexer) mustCurrentLineComment() string {
+	start := r.pos
+	for {
+		b, ok := r.peekNextChar()
+		if !ok || b == '\n' {
+			return r.input[start : r.pos+1]
+		}
+		r.advance()
+	}
+}
+
+// currentBlockComment returns the comment starting at the current "/*".
+// Block comments nest. ok is false if the input ends inside the comment.
+func (r *Lexer) currentBlockComment() (comment string, ok bool) {
+	start := r.pos
+	r.advance()
+	depth := 1
+	for depth > 0 {
+		b, ok := r.nextChar()
+		if !ok {
+			return r.input[start:], false
+		}
+		n, _ := r.peekNextChar()
+		if b == '/' && n == '*' {
+			r.advance()
+			depth++
+		} else if b == '*' && n == '/' {
+			r.advance()
+			depth--
+		}
+	}
+	return r.input[start : r.pos+1], true
+}
+
 func (r *Lexer) NextToken() *token.Token {
-	r.skipWhitespace()
+	for {
+		r.skipWhitespace()
+		start := r.pos + 1
+		t := r.scanToken()
+		if t.Type == token.Comment && r.mode&ScanComments == 0 {
+			continue
+		}
+		t.Pos = r.position(start)
+		t.End = r.position(r.pos + 1)
+		if t.Type == token.EOF {
+			t.Pos = r.position(len(r.input))
+			t.End = t.Pos
+		}
+		return t
+	}
+}
+
+func (r *Lexer) scanToken() *token.Token {
 	b, ok := r.nextChar()
 	if !ok {
 		return token.New(token.EOF, "")
@@ -129,6 +339,8 @@ func (r *Lexer) NextToken() *token.Token {
 	switch b {
 	case '"':
 		return token.New(token.String, r.mustCurrentString())
+	case '`':
+		return token.New(token.String, r.mustCurrentRawString())
 	case '=':
 		n, ok := r.peekNextChar()
 		if ok && n == '=' {
@@ -161,13 +373,50 @@ func (r *Lexer) NextToken() *token.Token {
 		} else {
 			return token.New(token.Lt, "<")
 		}
+	case '&':
+		if n, ok := r.peekNextChar(); ok && n == '&' {
+			r.advance()
+			return token.New(token.And, "&&")
+		}
+	case '|':
+		if n, ok := r.peekNextChar(); ok && n == '|' {
+			r.advance()
+			return token.New(token.Or, "||")
+		}
 	case '+':
+		if n, ok := r.peekNextChar(); ok && n == '=' {
+			r.advance()
+			return token.New(token.AddAssign, "+=")
+		}
 		return token.New(token.Add, "+")
 	case '-':
+		if n, ok := r.peekNextChar(); ok && n == '=' {
+			r.advance()
+			return token.New(token.SubAssign, "-=")
+		}
 		return token.New(token.Minus, "-")
 	case '/':
-		return token.New(token.Divide, "/")
+		n, _ := r.peekNextChar()
+		if n == '=' {
+			r.advance()
+			return token.New(token.DivAssign, "/=")
+		} else if n == '/' {
+			return token.New(token.Comment, r.mustCurrentLineComment())
+		} else if n == '*' {
+			start := r.pos
+			comment, ok := r.currentBlockComment()
+			if !ok {
+				r.errorf(UnterminatedComment, start, "unterminated comment")
+			}
+			return token.New(token.Comment, comment)
+		} else {
+			return token.New(token.Divide, "/")
+		}
 	case '*':
+		if n, ok := r.peekNextChar(); ok && n == '=' {
+			r.advance()
+			return token.New(token.MulAssign, "*=")
+		}
 		return token.New(token.Multiply, "*")
 	case ',':
 		return token.New(token.Comma, ",")
@@ -193,11 +442,66 @@ func (r *Lexer) NextToken() *token.Token {
 			identType := token.LookupIdent(ident)
 			return token.New(identType, ident)
 		} else if isDigit(b) {
-			n := r.mustCurrentNumber()
-			return token.New(token.Number, n)
+			return r.number()
 		}
 	}
-	return token.New(token.Illegal, "")
+	return r.invalidCharacter()
+}
+
+// number scans the number literal starting at the current digit: an integer,
+// or a float with a fraction and/or an exponent such as 3.14 or 1e-9. A
+// number immediately followed by letters is reported as invalid as a whole.
+func (r *Lexer) number() *token.Token {
+	start := r.pos
+	var typ token.TokenType = token.Number
+	valid := true
+	r.mustCurrentNumber()
+	if b, _ := r.peekNextChar(); b == '.' {
+		if d, ok := r.peekSecondChar(); ok && isDigit(d) {
+			typ = token.Float
+			r.advance()
+			r.advance()
+			r.mustCurrentNumber()
+		}
+	}
+	if b, _ := r.peekNextChar(); b == 'e' || b == 'E' {
+		typ = token.Float
+		r.advance()
+		if sign, _ := r.peekNextChar(); sign == '+' || sign == '-' {
+			r.advance()
+		}
+		if d, ok := r.peekNextChar(); ok && isDigit(d) {
+			r.advance()
+			r.mustCurrentNumber()
+		} else {
+			valid = false
+		}
+	}
+	if b, ok := r.peekNextChar(); ok && isLetter(b) {
+		for ok && (isLetter(b) || isDigit(b)) {
+			r.advance()
+			b, ok = r.peekNextChar()
+		}
+		valid = false
+	}
+	if !valid {
+		r.errorf(InvalidNumber, start, "invalid number literal %q", r.input[start:r.pos+1])
+	}
+	return token.New(typ, r.input[start:r.pos+1])
+}
+
+// invalidCharacter reports the character starting at the current position,
+// which cannot start a token, and returns it as an Illegal token.
+func (r *Lexer) invalidCharacter() *token.Token {
+	start := r.pos
+	ch, size := utf8.DecodeRuneInString(r.input[start:])
+	r.pos += size - 1
+	if ch == utf8.RuneError && size == 1 {
+		r.errorf(InvalidCharacter, start, "invalid UTF-8 byte %#x", r.input[start])
+	} else {
+		r.errorf(InvalidCharacter, start, "invalid character %U %q", ch, ch)
+	}
+	return token.New(token.Illegal, r.input[start:r.pos+1])
 }
 
 func isLetter(b byte) bool {
@@ -207,3 +511,16 @@ func isLetter(b byte) bool {
 func isDigit(b byte) bool {
 	return b >= '0' && b <= '9'
 }
+
+func hexValue(b byte) (int, bool) {
+	switch {
+	case b >= '0' && b <= '9':
+		return int(b - '0'), true
+	case b >= 'a' && b <= 'f':
+		return int(b-'a') + 10, true
+	case b >= 'A' && b <= 'F':
+		return int(b-'A') + 10, true
+	default:
+		return 0, false
+	}
+}
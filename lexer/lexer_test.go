@@ -35,7 +35,7 @@ func TestNextToken(t *testing.T) {
 			expTokens: nil,
 		},
 		{
-			input: "{(+=-)}",
+			input: "{(+ =-)}",
 			expTokens: []*token.Token{
 				token.New(token.LBrace, "{"),
 				token.New(token.LParen, "("),
@@ -69,7 +69,7 @@ func TestNextToken(t *testing.T) {
 		{
 			input: `var five = 5;
 var ten = 10;
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
    `,
 			expTokens: []*token.Token{
@@ -152,6 +152,243 @@ if (5 < 10) {
 				token.New(token.RBrace, "}"),
 			},
 		},
+		{
+			input: `a && b || !c`,
+			expTokens: []*token.Token{
+				token.New(token.Ident, "a"),
+				token.New(token.And, "&&"),
+				token.New(token.Ident, "b"),
+				token.New(token.Or, "||"),
+				token.New(token.Not, "!"),
+				token.New(token.Ident, "c"),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lexer := New(test.input)
+			for _, exp := range test.expTokens {
+				got := lexer.NextToken()
+				if !got.Equals(exp) {
+					t.Fatalf("got %v; want %v", got, exp)
+				}
+			}
+			last := lexer.NextToken()
+			if !last.Equals(token.New(token.EOF, "")) {
+				t.Fatalf("expect no token left; got %v", last)
+			}
+		})
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	lexer := NewFile("test.mk", "var s = \"ke\";\n  s == 10")
+	tests := []struct {
+		typ      token.TokenType
+		pos, end string
+		offset   int
+	}{
+		{token.Var, "test.mk:1:1", "test.mk:1:4", 0},
+		{token.Ident, "test.mk:1:5", "test.mk:1:6", 4},
+		{token.Assign, "test.mk:1:7", "test.mk:1:8", 6},
+		{token.String, "test.mk:1:9", "test.mk:1:13", 8},
+		{token.Semicolon, "test.mk:1:13", "test.mk:1:14", 12},
+		{token.Ident, "test.mk:2:3", "test.mk:2:4", 16},
+		{token.Equal, "test.mk:2:5", "test.mk:2:7", 18},
+		{token.Number, "test.mk:2:8", "test.mk:2:10", 21},
+		{token.EOF, "test.mk:2:10", "test.mk:2:10", 23},
+	}
+	for _, test := range tests {
+		got := lexer.NextToken()
+		if got.Type != test.typ {
+			t.Fatalf("got token %v; want type %v", got, test.typ)
+		}
+		if got.Pos.String() != test.pos || got.End.String() != test.end {
+			t.Fatalf("got %v at %v-%v; want %v-%v", got, got.Pos, got.End, test.pos, test.end)
+		}
+		if got.Pos.Offset != test.offset {
+			t.Fatalf("got %v at offset %v; want %v", got, got.Pos.Offset, test.offset)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input     string
+		expTokens []*token.Token
+	}{
+		{"#!/usr/bin/env mankey", nil},
+		{"#!/usr/bin/env mankey\n42", []*token.Token{token.New(token.Number, "42")}},
+	}
+	for _, test := range tests {
+		lexer := New(test.input)
+		lexer.SetMode(SkipShebang)
+		for _, exp := range test.expTokens {
+			got := lexer.NextToken()
+			if !got.Equals(exp) {
+				t.Fatalf("got %v; want %v", got, exp)
+			}
+			if got.Pos.Line != 2 {
+				t.Fatalf("got %v on line %v; want line 2", got, got.Pos.Line)
+			}
+		}
+		last := lexer.NextToken()
+		if !last.Equals(token.New(token.EOF, "")) {
+			t.Fatalf("expect no token left; got %v", last)
+		}
+	}
+
+	// Without SkipShebang, as for code that is not a script file, the line
+	// is not skipped.
+	if tok := New("#!/usr/bin/env mankey").NextToken(); tok.Type != token.Illegal {
+		t.Fatalf("got %v; want an illegal token", tok)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+var a = 1; // trailing
+/* block /* nested */ still comment */ a / 2
+/* unterminated`
+	tests := []struct {
+		mode      Mode
+		expTokens []*token.Token
+	}{
+		{
+			mode: 0,
+			expTokens: []*token.Token{
+				token.New(token.Var, "var"),
+				token.New(token.Ident, "a"),
+				token.New(token.Assign, "="),
+				token.New(token.Number, "1"),
+				token.New(token.Semicolon, ";"),
+				token.New(token.Ident, "a"),
+				token.New(token.Divide, "/"),
+				token.New(token.Number, "2"),
+			},
+		},
+		{
+			mode: ScanComments,
+			expTokens: []*token.Token{
+				token.New(token.Comment, "// leading"),
+				token.New(token.Var, "var"),
+				token.New(token.Ident, "a"),
+				token.New(token.Assign, "="),
+				token.New(token.Number, "1"),
+				token.New(token.Semicolon, ";"),
+				token.New(token.Comment, "// trailing"),
+				token.New(token.Comment, "/* block /* nested */ still comment */"),
+				token.New(token.Ident, "a"),
+				token.New(token.Divide, "/"),
+				token.New(token.Number, "2"),
+				token.New(token.Comment, "/* unterminated"),
+			},
+		},
+	}
+	for _, test := range tests {
+		lexer := New(input)
+		lexer.SetMode(test.mode)
+		for _, exp := range test.expTokens {
+			got := lexer.NextToken()
+			if !got.Equals(exp) {
+				t.Fatalf("got %v; want %v", got, exp)
+			}
+		}
+		last := lexer.NextToken()
+		if !last.Equals(token.New(token.EOF, "")) {
+			t.Fatalf("expect no token left; got %v", last)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		input  string
+		expStr string
+		expErr string
+	}{
+		{`"plain"`, "plain", ""},
+		{`"tab\there\nnewline"`, "tab\there\nnewline", ""},
+		{`"quote \" and backslash \\"`, `quote " and backslash \`, ""},
+		{`"\x41\x62"`, "Ab", ""},
+		{`"caf\u{e9} \u{1F600}"`, "café 😀", ""},
+		{`"café"`, "café", ""},
+		{"`raw \\n \"string\"\nover lines`", "raw \\n \"string\"\nover lines", ""},
+		{`"bad \q escape"`, `bad \q escape`, `1:6: invalid escape sequence "\\q"`},
+		{`"\x4"`, `\x4`, `1:2: invalid escape sequence "\\x4"`},
+		{`"\u{110000}"`, `\u{110000}`, `1:2: invalid escape sequence "\\u{110000}"`},
+	}
+	for _, test := range tests {
+		lexer := New(test.input)
+		got := lexer.NextToken()
+		if !got.Equals(token.New(token.String, test.expStr)) {
+			t.Fatalf("got %v; want string %q", got, test.expStr)
+		}
+		var gotErr string
+		if errs := lexer.Errors(); len(errs) != 0 {
+			gotErr = errs[0].Error()
+		}
+		if gotErr != test.expErr {
+			t.Fatalf("got error %q for %v; want %q", gotErr, test.input, test.expErr)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input     string
+		expTokens []*token.Token
+		expKind   ErrorKind
+		expErr    string
+	}{
+		{
+			input:     `var s = "abc`,
+			expTokens: []*token.Token{token.New(token.Var, "var"), token.New(token.Ident, "s"), token.New(token.Assign, "="), token.New(token.String, "abc")},
+			expKind:   UnterminatedString,
+			expErr:    "1:9: unterminated string",
+		},
+		{
+			input:     "`abc\n",
+			expTokens: []*token.Token{token.New(token.String, "abc\n")},
+			expKind:   UnterminatedString,
+			expErr:    "1:1: unterminated string",
+		},
+		{
+			input:     `"abc\`,
+			expTokens: []*token.Token{token.New(token.String, "abc")},
+			expKind:   UnterminatedString,
+			expErr:    "1:1: unterminated string",
+		},
+		{
+			input:     "1 /* /* */",
+			expTokens: []*token.Token{token.New(token.Number, "1")},
+			expKind:   UnterminatedComment,
+			expErr:    "1:3: unterminated comment",
+		},
+		{
+			input:     "a # b",
+			expTokens: []*token.Token{token.New(token.Ident, "a"), token.New(token.Illegal, "#"), token.New(token.Ident, "b")},
+			expKind:   InvalidCharacter,
+			expErr:    "1:3: invalid character U+0023 '#'",
+		},
+		{
+			input:     "a & b",
+			expTokens: []*token.Token{token.New(token.Ident, "a"), token.New(token.Illegal, "&"), token.New(token.Ident, "b")},
+			expKind:   InvalidCharacter,
+			expErr:    "1:3: invalid character U+0026 '&'",
+		},
+		{
+			input:     "\n é",
+			expTokens: []*token.Token{token.New(token.Illegal, "é")},
+			expKind:   InvalidCharacter,
+			expErr:    "2:2: invalid character U+00E9 'é'",
+		},
+		{
+			input:     "12ab3 + 1",
+			expTokens: []*token.Token{token.New(token.Number, "12ab3"), token.New(token.Add, "+"), token.New(token.Number, "1")},
+			expKind:   InvalidNumber,
+			expErr:    `1:1: invalid number literal "12ab3"`,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.input, func(t *testing.T) {
@@ -166,6 +403,87 @@ if (5 < 10) {
 			if !last.Equals(token.New(token.EOF, "")) {
 				t.Fatalf("expect no token left; got %v", last)
 			}
+			errs := lexer.Errors()
+			if len(errs) != 1 {
+				t.Fatalf("expected to get 1 error; got %v", errs)
+			}
+			if errs[0].Kind != test.expKind || errs[0].Error() != test.expErr {
+				t.Fatalf("got error %q; want %q", errs[0], test.expErr)
+			}
 		})
 	}
 }
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expToken *token.Token
+		expErr   string
+	}{
+		{"42", token.New(token.Number, "42"), ""},
+		{"3.14", token.New(token.Float, "3.14"), ""},
+		{"1e-9", token.New(token.Float, "1e-9"), ""},
+		{"2.5E+10", token.New(token.Float, "2.5E+10"), ""},
+		{"6e3", token.New(token.Float, "6e3"), ""},
+		{"1e", token.New(token.Float, "1e"), `1:1: invalid number literal "1e"`},
+		{"1.5x", token.New(token.Float, "1.5x"), `1:1: invalid number literal "1.5x"`},
+	}
+	for _, test := range tests {
+		lexer := New(test.input)
+		got := lexer.NextToken()
+		if !got.Equals(test.expToken) {
+			t.Fatalf("got %v; want %v", got, test.expToken)
+		}
+		var gotErr string
+		if errs := lexer.Errors(); len(errs) != 0 {
+			gotErr = errs[0].Error()
+		}
+		if gotErr != test.expErr {
+			t.Fatalf("got error %q for %v; want %q", gotErr, test.input, test.expErr)
+		}
+		last := lexer.NextToken()
+		if !last.Equals(token.New(token.EOF, "")) {
+			t.Fatalf("expect no token left; got %v", last)
+		}
+	}
+}
+
+func TestAssignOperators(t *testing.T) {
+	input := "a = 1; a += 2; a -= b; a *= 3; a /= 4; a / = 5;"
+	expTokens := []*token.Token{
+		token.New(token.Ident, "a"), token.New(token.Assign, "="), token.New(token.Number, "1"), token.New(token.Semicolon, ";"),
+		token.New(token.Ident, "a"), token.New(token.AddAssign, "+="), token.New(token.Number, "2"), token.New(token.Semicolon, ";"),
+		token.New(token.Ident, "a"), token.New(token.SubAssign, "-="), token.New(token.Ident, "b"), token.New(token.Semicolon, ";"),
+		token.New(token.Ident, "a"), token.New(token.MulAssign, "*="), token.New(token.Number, "3"), token.New(token.Semicolon, ";"),
+		token.New(token.Ident, "a"), token.New(token.DivAssign, "/="), token.New(token.Number, "4"), token.New(token.Semicolon, ";"),
+		token.New(token.Ident, "a"), token.New(token.Divide, "/"), token.New(token.Assign, "="), token.New(token.Number, "5"), token.New(token.Semicolon, ";"),
+		token.New(token.EOF, ""),
+	}
+	lexer := New(input)
+	for _, exp := range expTokens {
+		got := lexer.NextToken()
+		if !got.Equals(exp) {
+			t.Fatalf("got %v; want %v", got, exp)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := "while for in break continue info"
+	expTokens := []*token.Token{
+		token.New(token.While, "while"),
+		token.New(token.For, "for"),
+		token.New(token.In, "in"),
+		token.New(token.Break, "break"),
+		token.New(token.Continue, "continue"),
+		token.New(token.Ident, "info"),
+		token.New(token.EOF, ""),
+	}
+	lexer := New(input)
+	for _, exp := range expTokens {
+		got := lexer.NextToken()
+		if !got.Equals(exp) {
+			t.Fatalf("got %v; want %v", got, exp)
+		}
+	}
+}
@@ -1,11 +1,107 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/wangkekekexili/mankey/repl"
 )
 
+const usage = `Usage:
+	mankey                         start an interactive session
+	mankey run file.mk [args...]   run a script
+	mankey file.mk [args...]       run a script (for "#!/usr/bin/env mankey")
+	mankey -e 'code' [args...]     evaluate code and print the result
+	mankey fmt [flags] [paths...]  format programs (see "mankey fmt -h")
+
+Flags:
+	-vm         run scripts and code with the bytecode virtual machine
+	-O          optimize scripts and code before running them
+	-dump-ast   print the syntax tree of scripts and code, after the
+	            optimizations with -O, instead of running them
+
+The flags may also be given after run, as in "mankey run -vm file.mk". Script
+arguments are available to the program as the array "args".
+`
+
+// Exit codes of the mankey command.
+const (
+	exitOK    = 0
+	exitError = 1 // the program failed to parse or to run, or is not formatted
+	exitUsage = 2
+)
+
 func main() {
-	repl.Do(os.Stdin, os.Stdout)
+	os.Exit(runMain(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func runMain(arguments []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mankey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+	}
+	code := flags.String("e", "", "evaluate `code` and print the result")
+	var opts options
+	flags.BoolVar(&opts.vm, "vm", false, "run with the bytecode virtual machine")
+	flags.BoolVar(&opts.optimize, "O", false, "optimize before running")
+	flags.BoolVar(&opts.dumpAST, "dump-ast", false, "print the syntax tree instead of running")
+	if err := flags.Parse(arguments); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	arguments = flags.Args()
+
+	// An empty program given with -e is evaluated too.
+	if isSet(flags, "e") {
+		return evalSource("", *code, arguments, true, opts, stdout, stderr)
+	}
+	if len(arguments) > 0 && arguments[0] == "fmt" {
+		return runFmt(arguments[1:], stdin, stdout, stderr)
+	}
+	if len(arguments) == 0 {
+		repl.Do(stdin, stdout)
+		return exitOK
+	}
+	if arguments[0] == "run" {
+		// The flags may also follow run, as in "mankey run -vm file.mk".
+		if err := flags.Parse(arguments[1:]); err != nil {
+			if err == flag.ErrHelp {
+				return exitOK
+			}
+			return exitUsage
+		}
+		arguments = flags.Args()
+		if len(arguments) == 0 {
+			fmt.Fprintln(stderr, "mankey run: no script file given")
+			flags.Usage()
+			return exitUsage
+		}
+	}
+	return runFile(arguments[0], arguments[1:], opts, stdout, stderr)
+}
+
+// isSet tells whether the flag name was given on the command line.
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func runFile(filename string, args []string, opts options, stdout, stderr io.Writer) int {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return evalSource(filename, string(src), args, false, opts, stdout, stderr)
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mankey runs the mankey command with arguments and an empty standard input.
+func mankey(arguments ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = runMain(arguments, strings.NewReader(""), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRunMain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mankey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "script.mk")
+	src := "#!/usr/bin/env mankey\nputs(len(args));\nargs[0]\n"
+	if err := ioutil.WriteFile(script, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arguments []string
+		code      int
+		stdout    string
+		stderr    string // a prefix of the standard error
+	}{
+		{[]string{"-e", "1 + 2"}, exitOK, "3\n", ""},
+		{[]string{"-vm", "-e", "1 + 2"}, exitOK, "3\n", ""},
+		{[]string{"-O", "-e", "2 * 3"}, exitOK, "6\n", ""},
+		{[]string{"-e", "len(args)", "a", "b"}, exitOK, "2\n", ""},
+		{[]string{"-e", `puts("hi")`}, exitOK, "hi\n", ""},
+		{[]string{"-vm", "-e", `puts("hi")`}, exitOK, "hi\n", ""},
+		{[]string{"-e", "x"}, exitError, "", "1:1: undefined identifier x\n"},
+		{[]string{"-vm", "-e", "x"}, exitError, "", "1:1: undefined identifier x\n"},
+		{[]string{"-e", "1 +"}, exitError, "", "1:4: "},
+		{[]string{"-e", "1 / 0"}, exitError, "", "1:1: divide by zero\n"},
+		// An empty program is evaluated rather than starting a session.
+		{[]string{"-e", ""}, exitOK, "", ""},
+		// Code given with -e is not a script file: "#!" is invalid.
+		{[]string{"-e", "#!/usr/bin/env mankey\n1"}, exitError, "", "1:1: invalid character"},
+
+		// The result of a script is not printed, and its "#!" line is
+		// skipped.
+		{[]string{script, "a", "b"}, exitOK, "2\n", ""},
+		{[]string{"run", script, "a"}, exitOK, "1\n", ""},
+		{[]string{"-vm", "run", script, "a", "b", "c"}, exitOK, "3\n", ""},
+		// Flags may follow run, and the arguments after the script are its own.
+		{[]string{"run", "-vm", script, "-vm"}, exitOK, "1\n", ""},
+		{[]string{"run", "-unknown", script}, exitUsage, "", "flag provided but not defined: -unknown\n"},
+		{[]string{script}, exitError, "0\n", script + ":3:6: index 0 out of bound\n"},
+		{[]string{filepath.Join(dir, "missing.mk")}, exitError, "", "open "},
+
+		{[]string{"run"}, exitUsage, "", "mankey run: no script file given\n"},
+		{[]string{"-unknown"}, exitUsage, "", "flag provided but not defined: -unknown\n"},
+		{[]string{"-h"}, exitOK, "", "Usage:"},
+		{nil, exitOK, ">> ", ""},
+	}
+	for _, test := range tests {
+		code, stdout, stderr := mankey(test.arguments...)
+		if code != test.code || stdout != test.stdout || !strings.HasPrefix(stderr, test.stderr) {
+			t.Errorf("mankey %q: got %v, stdout %q, stderr %q; want %v, stdout %q, stderr %q...",
+				test.arguments, code, stdout, stderr, test.code, test.stdout, test.stderr)
+		}
+		if test.stderr == "" && stderr != "" {
+			t.Errorf("mankey %q: got stderr %q; want none", test.arguments, stderr)
+		}
+	}
+}
+
+func TestRunMainDumpAST(t *testing.T) {
+	code, stdout, stderr := mankey("-dump-ast", "-e", "1 + 2")
+	if code != exitOK || stderr != "" {
+		t.Fatalf("got %v, stderr %q; want %v", code, stderr, exitOK)
+	}
+	if !strings.HasPrefix(stdout, "Program 1:1-1:6\n") {
+		t.Fatalf("got %q; want the tree of the program", stdout)
+	}
+}
@@ -1,11 +1,23 @@
 package object
 
-type BuiltinFunction func(...Object) Object
+import (
+	"context"
+	"fmt"
+)
+
+// BuiltinFunction implements a builtin. It returns an error for invalid
+// arguments instead of panicking.
+type BuiltinFunction func(args ...Object) (Object, error)
 
 const ObjBuiltin = "BUILTIN"
 
 type Builtin struct {
-	Fn BuiltinFunction
+	Name string
+	Fn   BuiltinFunction
+
+	// ContextFn, if set, is called instead of Fn with the context of the
+	// evaluation, which carries values such as the writer of the output.
+	ContextFn func(ctx context.Context, args ...Object) (Object, error)
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -15,3 +27,31 @@ func (b *Builtin) Type() ObjectType {
 func (b *Builtin) String() string {
 	return ObjBuiltin
 }
+
+// CheckArgs returns an error unless the number of arguments is between min
+// and max inclusive. A negative max means there is no upper bound.
+func CheckArgs(args []Object, min, max int) error {
+	n := len(args)
+	switch {
+	case min == max && n != min:
+		return fmt.Errorf("expects %v; got %v", plural(min, "argument"), n)
+	case n < min:
+		return fmt.Errorf("expects at least %v; got %v", plural(min, "argument"), n)
+	case max >= 0 && n > max:
+		return fmt.Errorf("expects at most %v; got %v", plural(max, "argument"), n)
+	}
+	return nil
+}
+
+// ArgTypeError returns an error for the i-th argument, counting from 0, which
+// is not of the wanted type.
+func ArgTypeError(i int, want ObjectType, got Object) error {
+	return fmt.Errorf("argument %v must be %v; got %v", i+1, want, got.Type())
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%v %v", n, noun)
+	}
+	return fmt.Sprintf("%v %vs", n, noun)
+}
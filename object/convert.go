@@ -0,0 +1,420 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value to an object:
+//
+//   - nil and nil pointers become Null, and an Object is returned as it is;
+//   - bools, integers, floats and strings become the corresponding objects;
+//   - slices and arrays become arrays;
+//   - maps become hashes, with their keys in increasing order, and so do
+//     structs, keyed by the names of their exported fields in order or by
+//     the name in a `mankey:"name"` field tag;
+//   - functions become builtins, as with NewBuiltin.
+//
+// A value that refers to itself through pointers, maps or slices cannot be
+// converted.
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return Null, nil
+	}
+	if o, ok := v.(Object); ok {
+		return o, nil
+	}
+	return fromValue(reflect.ValueOf(v), nil)
+}
+
+// ref identifies a pointer, map or slice being converted.
+type ref struct {
+	t   reflect.Type
+	ptr uintptr
+	len int
+}
+
+// fromValue converts v, which is referred to through the pointers, maps and
+// slices in path.
+func fromValue(v reflect.Value, path map[ref]bool) (Object, error) {
+	if v.Type().Implements(objectType) && v.CanInterface() {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return Null, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			r := ref{t: v.Type(), ptr: v.Pointer()}
+			if v.Kind() == reflect.Slice {
+				r.len = v.Len()
+			}
+			if path[r] {
+				return nil, fmt.Errorf("cannot convert %v: it refers to itself", v.Type())
+			}
+			if path == nil {
+				path = make(map[ref]bool)
+			}
+			path[r] = true
+			defer delete(path, r)
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return True, nil
+		}
+		return False, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%v overflows integer", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return Null, nil
+		}
+		arr := &Array{Elements: make([]Object, 0, v.Len())}
+		for i := 0; i < v.Len(); i++ {
+			e, err := fromValue(v.Index(i), path)
+			if err != nil {
+				return nil, err
+			}
+			arr.Elements = append(arr.Elements, e)
+		}
+		return arr, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return Null, nil
+		}
+		h := NewHash()
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return lessKey(keys[i], keys[j])
+		})
+		for _, k := range keys {
+			kObj, err := fromValue(k, path)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := kObj.(HashKeyer); !ok {
+				return nil, fmt.Errorf("cannot use %v as a hash key", k.Type())
+			}
+			vObj, err := fromValue(v.MapIndex(k), path)
+			if err != nil {
+				return nil, err
+			}
+			h.Set(kObj, vObj)
+		}
+		return h, nil
+	case reflect.Struct:
+		h := NewHash()
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			vObj, err := fromValue(v.Field(i), path)
+			if err != nil {
+				return nil, err
+			}
+			h.Set(&String{Value: name}, vObj)
+		}
+		return h, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return Null, nil
+		}
+		return fromValue(v.Elem(), path)
+	case reflect.Func:
+		return newBuiltin("", v)
+	default:
+		return nil, fmt.Errorf("cannot convert %v to an object", v.Type())
+	}
+}
+
+// lessKey orders the keys of a Go map of booleans, integers or strings. Other
+// keys are left in any order.
+func lessKey(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.String:
+		return a.String() < b.String()
+	}
+	return false
+}
+
+// fieldName returns the name of a struct field in a hash, and false if the
+// field is unexported or tagged with `mankey:"-"`.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("mankey")
+	if tag == "-" {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return f.Name, true
+}
+
+// ToGo stores the value of o in the Go value pointed to by ptr. It is the
+// reverse of FromGo. When ptr points to an empty interface, integers become
+// int64, floats float64, arrays []interface{} and hashes
+// map[interface{}]interface{}.
+func ToGo(o Object, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("ToGo needs a non-nil pointer; got %T", ptr)
+	}
+	return toValue(o, v.Elem())
+}
+
+// toValue stores o in v, which must be settable.
+func toValue(o Object, v reflect.Value) error {
+	t := v.Type()
+	isEmptyInterface := t.Kind() == reflect.Interface && t.NumMethod() == 0
+	if !isEmptyInterface && reflect.TypeOf(o).AssignableTo(t) {
+		v.Set(reflect.ValueOf(o))
+		return nil
+	}
+	if o == Null {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := o.(*Boolean); ok {
+			v.SetBool(b.Value)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := o.(*Integer); ok {
+			if v.OverflowInt(i.Value) {
+				return fmt.Errorf("%v overflows %v", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := o.(*Integer); ok {
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return fmt.Errorf("%v overflows %v", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := o.(type) {
+		case *Float:
+			v.SetFloat(n.Value)
+			return nil
+		case *Integer:
+			v.SetFloat(float64(n.Value))
+			return nil
+		}
+	case reflect.String:
+		if s, ok := o.(*String); ok {
+			v.SetString(s.Value)
+			return nil
+		}
+	case reflect.Slice:
+		if arr, ok := o.(*Array); ok {
+			s := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+			for i, e := range arr.Elements {
+				if err := toValue(e, s.Index(i)); err != nil {
+					return fmt.Errorf("element %v: %v", i, err)
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+	case reflect.Array:
+		if arr, ok := o.(*Array); ok {
+			if len(arr.Elements) != t.Len() {
+				return fmt.Errorf("cannot convert an array of %v elements to %v", len(arr.Elements), t)
+			}
+			for i, e := range arr.Elements {
+				if err := toValue(e, v.Index(i)); err != nil {
+					return fmt.Errorf("element %v: %v", i, err)
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if h, ok := o.(*Hash); ok {
+			m := reflect.MakeMap(t)
+			for _, p := range h.Pairs {
+				k := reflect.New(t.Key()).Elem()
+				if err := toValue(p.K, k); err != nil {
+					return fmt.Errorf("key %v: %v", p.K, err)
+				}
+				e := reflect.New(t.Elem()).Elem()
+				if err := toValue(p.V, e); err != nil {
+					return fmt.Errorf("value of %v: %v", p.K, err)
+				}
+				m.SetMapIndex(k, e)
+			}
+			v.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if h, ok := o.(*Hash); ok {
+			for i := 0; i < t.NumField(); i++ {
+				name, ok := fieldName(t.Field(i))
+				if !ok {
+					continue
+				}
+				p, ok := h.Hash[(&String{Value: name}).HashKey()]
+				if !ok {
+					continue
+				}
+				if err := toValue(p.V, v.Field(i)); err != nil {
+					return fmt.Errorf("field %v: %v", name, err)
+				}
+			}
+			return nil
+		}
+	case reflect.Ptr:
+		e := reflect.New(t.Elem())
+		if err := toValue(o, e.Elem()); err != nil {
+			return err
+		}
+		v.Set(e)
+		return nil
+	case reflect.Interface:
+		if isEmptyInterface {
+			i, err := toInterface(o)
+			if err != nil {
+				return err
+			}
+			if i == nil {
+				v.Set(reflect.Zero(t))
+			} else {
+				v.Set(reflect.ValueOf(i))
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot convert %v to %v", o.Type(), t)
+}
+
+// toInterface converts o to its natural Go representation.
+func toInterface(o Object) (interface{}, error) {
+	switch o := o.(type) {
+	case *Integer:
+		return o.Value, nil
+	case *Float:
+		return o.Value, nil
+	case *Boolean:
+		return o.Value, nil
+	case *String:
+		return o.Value, nil
+	case *Array:
+		var s []interface{}
+		err := toValue(o, reflect.ValueOf(&s).Elem())
+		return s, err
+	case *Hash:
+		var m map[interface{}]interface{}
+		err := toValue(o, reflect.ValueOf(&m).Elem())
+		return m, err
+	default:
+		if o == Null {
+			return nil, nil
+		}
+		return o, nil
+	}
+}
+
+// NewBuiltin wraps the Go function fn as a builtin named name. The arguments
+// of a call are converted with ToGo into the parameter types of fn, and its
+// results with FromGo. fn may return no value, a value, an error, or a value
+// and an error. If fn is a BuiltinFunction, it is used as it is.
+func NewBuiltin(name string, fn interface{}) (*Builtin, error) {
+	if f, ok := fn.(func(...Object) (Object, error)); ok {
+		return &Builtin{Name: name, Fn: f}, nil
+	}
+	if f, ok := fn.(BuiltinFunction); ok {
+		return &Builtin{Name: name, Fn: f}, nil
+	}
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("cannot use %T as a builtin", fn)
+	}
+	return newBuiltin(name, v)
+}
+
+func newBuiltin(name string, fn reflect.Value) (*Builtin, error) {
+	t := fn.Type()
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && t.Out(1) != errorType:
+		return nil, fmt.Errorf("cannot use %v as a builtin: it must return at most a value and an error", t)
+	}
+
+	numIn := t.NumIn()
+	return &Builtin{
+		Name: name,
+		Fn: func(args ...Object) (Object, error) {
+			if t.IsVariadic() {
+				if err := CheckArgs(args, numIn-1, -1); err != nil {
+					return nil, err
+				}
+			} else if err := CheckArgs(args, numIn, numIn); err != nil {
+				return nil, err
+			}
+
+			in := make([]reflect.Value, len(args))
+			for i, arg := range args {
+				var pt reflect.Type
+				if t.IsVariadic() && i >= numIn-1 {
+					pt = t.In(numIn - 1).Elem()
+				} else {
+					pt = t.In(i)
+				}
+				in[i] = reflect.New(pt).Elem()
+				if err := toValue(arg, in[i]); err != nil {
+					return nil, fmt.Errorf("argument %v: %v", i+1, err)
+				}
+			}
+
+			out := fn.Call(in)
+			if n := len(out); n != 0 && out[n-1].Type() == errorType {
+				if err, _ := out[n-1].Interface().(error); err != nil {
+					return nil, err
+				}
+				out = out[:n-1]
+			}
+			if len(out) == 0 {
+				return Null, nil
+			}
+			return fromValue(out[0], nil)
+		},
+	}, nil
+}
@@ -0,0 +1,185 @@
+package object
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y  int
+	Label string `mankey:"label"`
+	Note  string `mankey:"-"`
+	note  string
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		v   interface{}
+		exp string
+	}{
+		{nil, "NULL"},
+		{true, "true"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{"hi", "hi"},
+		{[]int{1, 2, 3}, "[1,2,3]"},
+		{[2]string{"a", "b"}, "[a,b]"},
+		{map[string]int{"b": 2, "a": 1, "c": 3}, "{a: 1,b: 2,c: 3}"},
+		{map[int]bool{10: true, -1: false, 9: true}, "{-1: false,9: true,10: true}"},
+		{point{X: 1}, ""},
+		{&Integer{Value: 3}, "3"},
+		{(*int)(nil), "NULL"},
+	}
+	for _, test := range tests {
+		o, err := FromGo(test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.exp != "" && o.String() != test.exp {
+			t.Fatalf("got %v for %#v; want %v", o, test.v, test.exp)
+		}
+	}
+
+	o, err := FromGo(point{X: 1, Y: 2, Label: "p", Note: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := o.(*Hash)
+	if !ok {
+		t.Fatalf("expected a hash; got %T", o)
+	}
+	if len(h.Hash) != 3 {
+		t.Fatalf("expected 3 fields; got %v", h)
+	}
+	if p, ok := h.Hash[(&String{Value: "label"}).HashKey()]; !ok || p.V.String() != "p" {
+		t.Fatalf("expected the label field to be p; got %v", h)
+	}
+
+	if _, err := FromGo(uint64(1 << 63)); err == nil {
+		t.Fatal("expected an overflow error")
+	}
+	if _, err := FromGo(make(chan int)); err == nil {
+		t.Fatal("expected an error for a channel")
+	}
+}
+
+func TestFromGoCycles(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	m := map[string]interface{}{}
+	m["m"] = m
+	s := []interface{}{nil}
+	s[0] = s
+	for _, v := range []interface{}{n, m, s} {
+		if _, err := FromGo(v); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+			t.Errorf("FromGo of a cyclic %T: got error %v", v, err)
+		}
+	}
+
+	// A value may be referred to more than once without a cycle.
+	shared := &node{}
+	o, err := FromGo([]*node{shared, shared})
+	if err != nil || o.String() != "[{Next: NULL},{Next: NULL}]" {
+		t.Fatalf("got %v, %v", o, err)
+	}
+}
+
+func TestToGo(t *testing.T) {
+	var i int
+	if err := ToGo(&Integer{Value: 42}, &i); err != nil || i != 42 {
+		t.Fatalf("got %v, %v; want 42", i, err)
+	}
+	var i8 int8
+	if err := ToGo(&Integer{Value: 1000}, &i8); err == nil {
+		t.Fatal("expected an overflow error")
+	}
+	var f float64
+	if err := ToGo(&Integer{Value: 2}, &f); err != nil || f != 2 {
+		t.Fatalf("got %v, %v; want 2", f, err)
+	}
+	var s string
+	if err := ToGo(&Integer{Value: 2}, &s); err == nil {
+		t.Fatal("expected a type error")
+	}
+
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}, True, Null}}
+	var v interface{}
+	if err := ToGo(arr, &v); err != nil {
+		t.Fatal(err)
+	}
+	exp := []interface{}{int64(1), "a", true, nil}
+	if !reflect.DeepEqual(v, exp) {
+		t.Fatalf("got %#v; want %#v", v, exp)
+	}
+
+	o, err := FromGo(point{X: 1, Y: 2, Label: "p", Note: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p point
+	if err := ToGo(o, &p); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (point{X: 1, Y: 2, Label: "p"}); p != exp {
+		t.Fatalf("got %+v; want %+v", p, exp)
+	}
+
+	var m map[string]int
+	if err := ToGo(o, &m); err == nil {
+		t.Fatal("expected an error for the string field")
+	}
+}
+
+func TestNewBuiltin(t *testing.T) {
+	add, err := NewBuiltin("add", func(a, b int) int { return a + b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := add.Fn(&Integer{Value: 1}, &Integer{Value: 2})
+	if err != nil || o.String() != "3" {
+		t.Fatalf("got %v, %v; want 3", o, err)
+	}
+	if _, err := add.Fn(&Integer{Value: 1}); err == nil || err.Error() != "expects 2 arguments; got 1" {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := add.Fn(&Integer{Value: 1}, True); err == nil || err.Error() != "argument 2: cannot convert BOOLEAN to int" {
+		t.Fatalf("got error %v", err)
+	}
+
+	join, err := NewBuiltin("join", func(sep string, parts ...string) (string, error) {
+		if len(parts) == 0 {
+			return "", errors.New("nothing to join")
+		}
+		var s string
+		for i, p := range parts {
+			if i > 0 {
+				s += sep
+			}
+			s += p
+		}
+		return s, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err = join.Fn(&String{Value: "-"}, &String{Value: "a"}, &String{Value: "b"})
+	if err != nil || o.String() != "a-b" {
+		t.Fatalf("got %v, %v; want a-b", o, err)
+	}
+	if _, err := join.Fn(&String{Value: "-"}); err == nil || err.Error() != "nothing to join" {
+		t.Fatalf("got error %v", err)
+	}
+
+	if _, err := NewBuiltin("bad", func() (int, int) { return 0, 0 }); err == nil {
+		t.Fatal("expected an error for a function returning two values")
+	}
+	if _, err := NewBuiltin("bad", 1); err == nil {
+		t.Fatal("expected an error for a non function")
+	}
+}
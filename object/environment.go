@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
@@ -29,3 +31,25 @@ func (e *Environment) Get(i string) (Object, bool) {
 func (e *Environment) Set(i string, o Object) {
 	e.store[i] = o
 }
+
+// Assign updates the nearest binding of i in e or its outer environments. It
+// reports false if i is not bound.
+func (e *Environment) Assign(i string, o Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[i]; ok {
+			env.store[i] = o
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the sorted names bound in e, excluding outer environments.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,25 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+)
+
+const ObjFloat = "FLOAT"
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return ObjFloat
+}
+
+// String formats f so that it can be told apart from an integer.
+func (f *Float) String() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
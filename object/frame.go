@@ -0,0 +1,21 @@
+package object
+
+// Frame holds the locals of a function call, in the slots assigned to them
+// by the resolver. A slot is nil until its variable is set.
+type Frame struct {
+	Slots []Object
+	Outer *Frame // the frame of the call the function was defined in, if any
+}
+
+// NewFrame returns a frame of n slots enclosed in outer.
+func NewFrame(n int, outer *Frame) *Frame {
+	return &Frame{Slots: make([]Object, n), Outer: outer}
+}
+
+// Up returns the frame depth levels out from f.
+func (f *Frame) Up(depth int) *Frame {
+	for ; depth > 0; depth-- {
+		f = f.Outer
+	}
+	return f
+}
@@ -9,9 +9,12 @@ import (
 const ObjFunction = "FUNCTION"
 
 type Function struct {
+	Name       string // the name the function was declared with, if any
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
-	Env        *Environment
+	NumSlots   int          // number of locals of a call
+	Env        *Environment // the globals
+	Frame      *Frame       // the locals of the enclosing function, if any
 }
 
 func (f *Function) Type() ObjectType {
@@ -11,8 +11,29 @@ type HashPair struct {
 	K, V Object
 }
 
+// Hash maps keys to values. Pairs lists the pairs in the order their keys
+// were first set, which is the order of iteration and printing, and Hash
+// indexes them by key. Pairs are added with Set, which keeps both up to date.
 type Hash struct {
-	Hash map[HashKey]*HashPair
+	Pairs []*HashPair
+	Hash  map[HashKey]*HashPair
+}
+
+func NewHash() *Hash {
+	return &Hash{Hash: make(map[HashKey]*HashPair)}
+}
+
+// Set sets the value of key k, which must be a HashKeyer, to v. A key that
+// is already set keeps its place in the order.
+func (h *Hash) Set(k, v Object) {
+	key := k.(HashKeyer).HashKey()
+	if p, ok := h.Hash[key]; ok {
+		p.V = v
+		return
+	}
+	p := &HashPair{K: k, V: v}
+	h.Pairs = append(h.Pairs, p)
+	h.Hash[key] = p
 }
 
 func (h *Hash) Type() ObjectType {
@@ -21,8 +42,8 @@ func (h *Hash) Type() ObjectType {
 
 func (h *Hash) String() string {
 	var strs []string
-	for _, v := range h.Hash {
-		strs = append(strs, fmt.Sprintf("%v: %v", v.K, v.V))
+	for _, p := range h.Pairs {
+		strs = append(strs, fmt.Sprintf("%v: %v", p.K, p.V))
 	}
 	return "{" + strings.Join(strs, ",") + "}"
 }
@@ -0,0 +1,26 @@
+package object
+
+const (
+	ObjBreak    = "BREAK"
+	ObjContinue = "CONTINUE"
+)
+
+// Break and Continue are returned by break and continue statements. Like a
+// ReturnValue, they stop the evaluation of the enclosing blocks until they
+// reach the innermost loop.
+var (
+	Break    = &loopSignal{typ: ObjBreak}
+	Continue = &loopSignal{typ: ObjContinue}
+)
+
+type loopSignal struct {
+	typ ObjectType
+}
+
+func (s *loopSignal) Type() ObjectType {
+	return s.typ
+}
+
+func (s *loopSignal) String() string {
+	return string(s.typ)
+}
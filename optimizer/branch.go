@@ -0,0 +1,99 @@
+package optimizer
+
+import "github.com/wangkekekexili/mankey/ast"
+
+type deadBranchElimination struct{}
+
+func (deadBranchElimination) Name() string {
+	return "branch"
+}
+
+// Optimize removes the branches of if expressions whose condition is a
+// boolean literal. An if expression used as a statement is replaced by the
+// statements of the branch taken, which is equivalent since blocks do not
+// introduce scopes. Elsewhere, it is replaced by the branch taken if that is
+// a single literal, which takes the position of the if expression for the
+// errors reported at it. A branch that declares a variable is kept, so that
+// the variables of the program do not change.
+func (deadBranchElimination) Optimize(program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Program:
+			n.Statements = eliminateStatements(n.Statements)
+		case *ast.BlockStatement:
+			n.Statements = eliminateStatements(n.Statements)
+		}
+		return true
+	})
+	rewrite(program, eliminateExpression)
+}
+
+// liveBranch returns the branch of ifExpr that is taken, which is nil if
+// there is none, if its condition is a literal and the other branch can be
+// removed.
+func liveBranch(ifExpr *ast.IfExpression) (*ast.BlockStatement, bool) {
+	cond, ok := ifExpr.Condition.(*ast.Boolean)
+	if !ok {
+		return nil, false
+	}
+	live, dead := ifExpr.Consequence, ifExpr.Alternative
+	if !cond.Value {
+		live, dead = dead, live
+	}
+	if dead != nil && hasDeclarations(dead) {
+		return nil, false
+	}
+	return live, true
+}
+
+// eliminateStatements replaces the if statements with a literal condition in
+// stats by the statements of the branch taken. The last statement is kept if
+// there are none, as it gives the value of stats.
+func eliminateStatements(stats []ast.Statement) []ast.Statement {
+	for {
+		var out []ast.Statement
+		changed := false
+		for i, stat := range stats {
+			var live *ast.BlockStatement
+			ok := false
+			if stat, isExpr := stat.(*ast.ExpressionStatement); isExpr {
+				if ifExpr, isIf := stat.Value.(*ast.IfExpression); isIf {
+					live, ok = liveBranch(ifExpr)
+				}
+			}
+			last := i == len(stats)-1
+			if !ok || (last && (live == nil || len(live.Statements) == 0)) {
+				out = append(out, stat)
+				continue
+			}
+			changed = true
+			if live != nil {
+				out = append(out, live.Statements...)
+			}
+		}
+		if !changed {
+			return out
+		}
+		stats = out
+	}
+}
+
+func eliminateExpression(expr ast.Expression) ast.Expression {
+	ifExpr, ok := expr.(*ast.IfExpression)
+	if !ok {
+		return expr
+	}
+	live, ok := liveBranch(ifExpr)
+	if !ok || live == nil || len(live.Statements) != 1 {
+		return expr
+	}
+	stat, ok := live.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return expr
+	}
+	value, ok := literalValue(stat.Value)
+	if !ok {
+		return expr
+	}
+	return literal(ifExpr.Span, value, expr)
+}
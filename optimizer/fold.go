@@ -0,0 +1,100 @@
+package optimizer
+
+import (
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/evaluator"
+	"github.com/wangkekekexili/mankey/object"
+)
+
+type constantFolding struct{}
+
+func (constantFolding) Name() string {
+	return "fold"
+}
+
+// Optimize folds the operators whose operands are literals, innermost
+// first, so that whole constant expressions become literals. An operation
+// that fails, like a division by zero, is left for the error to be reported
+// when the program runs.
+func (constantFolding) Optimize(program *ast.Program) {
+	rewrite(program, fold)
+}
+
+func fold(expr ast.Expression) ast.Expression {
+	switch n := expr.(type) {
+	case *ast.PrefixExpression:
+		value, ok := literalValue(n.Value)
+		if !ok {
+			return n
+		}
+		o, err := evaluator.Prefix(n, value)
+		if err != nil {
+			return n
+		}
+		return literal(n.Span, o, n)
+	case *ast.InfixExpression:
+		if n.Op == "&&" || n.Op == "||" {
+			return foldLogical(n)
+		}
+		left, ok := literalValue(n.Left)
+		if !ok {
+			return n
+		}
+		right, ok := literalValue(n.Right)
+		if !ok || left.Type() != right.Type() {
+			return n
+		}
+		o, err := evaluator.Infix(n, n.Op, left, right)
+		if err != nil {
+			return n
+		}
+		return literal(n.Span, o, n)
+	}
+	return expr
+}
+
+// foldLogical folds && and || if the left operand decides the result, or if
+// both operands are boolean literals.
+func foldLogical(n *ast.InfixExpression) ast.Expression {
+	left, ok := n.Left.(*ast.Boolean)
+	if !ok {
+		return n
+	}
+	if left.Value == (n.Op == "||") {
+		if hasDeclarations(n.Right) {
+			return n
+		}
+		return &ast.Boolean{Span: n.Span, Value: left.Value}
+	}
+	right, ok := n.Right.(*ast.Boolean)
+	if !ok {
+		return n
+	}
+	return &ast.Boolean{Span: n.Span, Value: right.Value}
+}
+
+// literalValue returns the value of an integer, string or boolean literal.
+func literalValue(expr ast.Expression) (object.Object, bool) {
+	switch n := expr.(type) {
+	case *ast.Integer:
+		return &object.Integer{Value: n.Value}, true
+	case *ast.String:
+		return &object.String{Value: n.Value}, true
+	case *ast.Boolean:
+		return &object.Boolean{Value: n.Value}, true
+	}
+	return nil, false
+}
+
+// literal returns a literal of o spanning span, or orig if o has no literal.
+func literal(span ast.Span, o object.Object, orig ast.Expression) ast.Expression {
+	switch o := o.(type) {
+	case *object.Integer:
+		return &ast.Integer{Span: span, Value: o.Value}
+	case *object.String:
+		return &ast.String{Span: span, Value: o.Value}
+	case *object.Boolean:
+		return &ast.Boolean{Span: span, Value: o.Value}
+	}
+	return orig
+}
@@ -0,0 +1,209 @@
+package optimizer
+
+import "github.com/wangkekekexili/mankey/ast"
+
+// maxInlineNodes is the largest number of nodes in the body of a function
+// that is inlined.
+const maxInlineNodes = 16
+
+type inlining struct{}
+
+func (inlining) Name() string {
+	return "inline"
+}
+
+// Optimize inlines the calls of the global functions that are declared once
+// by a top-level var statement, never assigned, and whose body is a single
+// expression built from literals, operators and indexing that uses each of
+// the parameters once, in order. Such a function cannot be recursive, and
+// evaluating its body after substituting the arguments evaluates the same
+// expressions in the same order as the call. Only the calls with literal and
+// identifier arguments in the statements after the declaration are inlined,
+// as the function is known to be defined when they run.
+func (inlining) Optimize(program *ast.Program) {
+	candidates := inlineCandidates(program)
+	if len(candidates) == 0 {
+		return
+	}
+	for i, stat := range program.Statements {
+		rewrite(stat, func(expr ast.Expression) ast.Expression {
+			call, ok := expr.(*ast.CallExpression)
+			if !ok {
+				return expr
+			}
+			id, ok := call.Function.(*ast.Identifier)
+			if !ok || id.Local {
+				return expr
+			}
+			c, ok := candidates[id.Value]
+			if !ok || c.index >= i {
+				return expr
+			}
+			return c.inline(call)
+		})
+	}
+}
+
+// inlineCandidate is a function that can be inlined.
+type inlineCandidate struct {
+	index int // the index of the statement declaring the function
+	fn    *ast.Function
+	body  ast.Expression
+}
+
+// inlineCandidates returns the functions of program that can be inlined by
+// their names.
+func inlineCandidates(program *ast.Program) map[string]*inlineCandidate {
+	candidates := make(map[string]*inlineCandidate)
+	for i, stat := range program.Statements {
+		v, ok := stat.(*ast.VarStatement)
+		if !ok {
+			continue
+		}
+		fn, ok := v.Value.(*ast.Function)
+		if !ok {
+			continue
+		}
+		if body, ok := inlineBody(fn); ok {
+			candidates[v.Name.Value] = &inlineCandidate{index: i, fn: fn, body: body}
+		}
+	}
+
+	// Drop the names that are bound more than once.
+	declared := make(map[string]int)
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Function:
+			return false
+		case *ast.VarStatement:
+			declared[n.Name.Value]++
+		case *ast.ForInStatement:
+			declared[n.Variable.Value]++
+		}
+		return true
+	})
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n, ok := n.(*ast.AssignStatement); ok {
+			if id, ok := n.Target.(*ast.Identifier); ok && !id.Local {
+				declared[id.Value]++
+			}
+		}
+		return true
+	})
+	for name := range candidates {
+		if declared[name] != 1 {
+			delete(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// inlineBody returns the expression fn evaluates to, if it can be inlined.
+func inlineBody(fn *ast.Function) (ast.Expression, bool) {
+	if len(fn.Body.Statements) != 1 {
+		return nil, false
+	}
+	var body ast.Expression
+	switch stat := fn.Body.Statements[0].(type) {
+	case *ast.ExpressionStatement:
+		body = stat.Value
+	case *ast.ReturnStatement:
+		body = stat.Value
+	default:
+		return nil, false
+	}
+
+	params := make(map[string]bool)
+	for _, p := range fn.Parameters {
+		if params[p.Value] {
+			return nil, false
+		}
+		params[p.Value] = true
+	}
+	var used []string
+	nodes := 0
+	ok := true
+	ast.Inspect(body, func(n ast.Node) bool {
+		nodes++
+		switch n := n.(type) {
+		case *ast.Integer, *ast.Float, *ast.String, *ast.Boolean,
+			*ast.Array, *ast.IndexExpression, *ast.PrefixExpression:
+		case *ast.InfixExpression:
+			ok = ok && n.Op != "&&" && n.Op != "||"
+		case *ast.Identifier:
+			ok = ok && params[n.Value]
+			used = append(used, n.Value)
+		default:
+			ok = false
+		}
+		return ok
+	})
+	if !ok || nodes > maxInlineNodes || len(used) != len(fn.Parameters) {
+		return nil, false
+	}
+	for i, p := range fn.Parameters {
+		if used[i] != p.Value {
+			return nil, false
+		}
+	}
+	return body, true
+}
+
+// inline returns the body of the function with the parameters replaced by
+// the arguments of call, or call if it cannot be inlined. The errors of the
+// body are reported at call. The body is folded
+// so that it can be the argument of another inlined call if it is constant.
+func (c *inlineCandidate) inline(call *ast.CallExpression) ast.Expression {
+	if len(call.Arguments) != len(c.fn.Parameters) {
+		return call
+	}
+	args := make(map[string]ast.Expression)
+	for i, a := range call.Arguments {
+		switch a.(type) {
+		case *ast.Integer, *ast.Float, *ast.String, *ast.Boolean, *ast.Identifier:
+		default:
+			return call
+		}
+		args[c.fn.Parameters[i].Value] = a
+	}
+	return rewriter(fold).expression(substitute(c.body, args, call.Span))
+}
+
+// substitute returns a copy of an inlinable body with its identifiers
+// replaced by args, and the other nodes spanning span.
+func substitute(expr ast.Expression, args map[string]ast.Expression, span ast.Span) ast.Expression {
+	switch n := expr.(type) {
+	case *ast.Identifier:
+		return args[n.Value]
+	case *ast.Integer:
+		return &ast.Integer{Span: span, Value: n.Value}
+	case *ast.Float:
+		return &ast.Float{Span: span, Value: n.Value}
+	case *ast.String:
+		return &ast.String{Span: span, Value: n.Value}
+	case *ast.Boolean:
+		return &ast.Boolean{Span: span, Value: n.Value}
+	case *ast.Array:
+		elements := make([]ast.Expression, len(n.Elements))
+		for i, e := range n.Elements {
+			elements[i] = substitute(e, args, span)
+		}
+		return &ast.Array{Span: span, Elements: elements}
+	case *ast.IndexExpression:
+		return &ast.IndexExpression{
+			Span:  span,
+			Left:  substitute(n.Left, args, span),
+			Index: substitute(n.Index, args, span),
+		}
+	case *ast.PrefixExpression:
+		return &ast.PrefixExpression{Span: span, Op: n.Op, Value: substitute(n.Value, args, span)}
+	case *ast.InfixExpression:
+		return &ast.InfixExpression{
+			Span:  span,
+			Left:  substitute(n.Left, args, span),
+			Op:    n.Op,
+			Right: substitute(n.Right, args, span),
+		}
+	}
+	return expr
+}
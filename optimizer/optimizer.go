@@ -0,0 +1,67 @@
+// Package optimizer rewrites programs into equivalent ones that do less work
+// when they run.
+//
+// An optimized program produces the same results and errors as the original
+// one, with a few exceptions: the errors in inlined functions are reported at
+// their calls, which do not appear in tracebacks and do not count towards
+// Limits.MaxDepth, strings built by
+// constant folding are not checked against Limits.MaxStringLen, and
+// undefined variables are not reported in code that is removed because it
+// never runs.
+package optimizer
+
+import (
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/resolver"
+)
+
+// Pass is an optimization of programs.
+type Pass interface {
+	// Name returns the name of the pass.
+	Name() string
+	// Optimize rewrites program in place.
+	Optimize(program *ast.Program)
+}
+
+// The passes implemented by the package.
+var (
+	// ConstantFolding replaces the operators applied to integer, string and
+	// boolean literals by their results.
+	ConstantFolding Pass = constantFolding{}
+	// DeadBranchElimination replaces if expressions with a literal condition
+	// by the branch taken.
+	DeadBranchElimination Pass = deadBranchElimination{}
+	// Inlining replaces the calls of small global functions by their bodies.
+	Inlining Pass = inlining{}
+)
+
+// DefaultPasses are the passes run by Optimize if none is given, in order.
+var DefaultPasses = []Pass{Inlining, ConstantFolding, DeadBranchElimination}
+
+// Optimize runs passes over program, or DefaultPasses if there are none, and
+// resolves the identifiers of the result.
+func Optimize(program *ast.Program, passes ...Pass) {
+	if len(passes) == 0 {
+		passes = DefaultPasses
+	}
+	for _, p := range passes {
+		p.Optimize(program)
+	}
+	resolver.Resolve(program)
+}
+
+// Lookup returns the pass named name.
+func Lookup(name string) (Pass, bool) {
+	for _, p := range []Pass{ConstantFolding, DeadBranchElimination, Inlining} {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// hasDeclarations tells whether removing node from a program would remove
+// the declaration of a variable.
+func hasDeclarations(node ast.Node) bool {
+	return len(resolver.Declarations(node)) > 0
+}
@@ -0,0 +1,161 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/wangkekekexili/mankey/evaluator"
+)
+
+func testPass(t *testing.T, pass Pass, tests []struct{ input, expected string }) {
+	for _, test := range tests {
+		program, err := evaluator.Parse("", test.input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", test.input, err)
+		}
+		Optimize(program, pass)
+		if got := program.String(); got != test.expected {
+			t.Errorf("%v pass on %q: expect %q; got %q", pass.Name(), test.input, test.expected, got)
+		}
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	testPass(t, ConstantFolding, []struct{ input, expected string }{
+		{"60 * 60 * 24", "86400;"},
+		{"1 + 2 * x", "(1+(2*x));"},
+		{"x + 2 * 3", "(x+6);"},
+		{`"a" + "b" + "c"`, "\"abc\";"},
+		{"-(1 + 2)", "-3;"},
+		{"!(1 < 2)", "false;"},
+		{"true == false", "false;"},
+		{"1 == true", "(1==true);"},
+		{"1 / 0", "(1/0);"},
+		{`"a" - "b"`, "(\"a\"-\"b\");"},
+		{"-true", "(-true);"},
+		{"1.5 + 1", "(1.5+1);"},
+		{"false && x", "false;"},
+		{"true || x", "true;"},
+		{"true && false", "false;"},
+		{"true && x", "(true&&x);"},
+		{"x || true", "(x||true);"},
+		{"false && if (x) { var y = 1; true }", "(false&&if (x) {var y = 1;true;});"},
+		{"var f = func() { 2 * 3 }", "var f = func () {6;};"},
+		{"[1 + 1, x[2 - 1]]", "[2,(x[1])];"},
+		{"x = 1 + 1", "x = 2;"},
+	})
+}
+
+func TestDeadBranchElimination(t *testing.T) {
+	testPass(t, DeadBranchElimination, []struct{ input, expected string }{
+		{"if (true) { 1 } else { 2 }", "1;"},
+		{"if (false) { 1 } else { 2 }", "2;"},
+		{"if (false) { 1 }; 2", "2;"},
+		{"if (false) { 1 }", "if (false) {1;};"},
+		{"if (true) { }", "if (true) {};"},
+		{"if (true) { 1; 2 }; 3", "1;2;3;"},
+		{"if (true) { if (false) { 1 } else { 2 } }", "2;"},
+		{"if (x) { 1 } else { 2 }", "if (x) {1;} else {2;};"},
+		{"var y = if (true) { 1 } else { 2 }", "var y = 1;"},
+		{"var y = if (true) { 1; 2 }", "var y = if (true) {1;2;};"},
+		{"var y = if (true) { x }", "var y = if (true) {x;};"},
+		{"var y = if (false) { 1 }", "var y = if (false) {1;};"},
+		{"while (x) { if (true) { break } }", "while (x) {break;}"},
+		{"if (true) { var y = 1 }; y", "var y = 1;y;"},
+		{"if (false) { var y = 1 }; 2", "if (false) {var y = 1;};2;"},
+		{"if (1 < 2) { 1 }", "if ((1<2)) {1;};"},
+	})
+}
+
+func TestInlining(t *testing.T) {
+	testPass(t, Inlining, []struct{ input, expected string }{
+		{"var f = func(x) { x + 1 }; f(2)", "var f = func (x) {(x+1);};3;"},
+		{"var f = func(x) { return x + 1 }; f(a)", "var f = func (x) {return (x+1);};(a+1);"},
+		{"var f = func(a, b) { a[b] }; f(x, 0)", "var f = func (a, b) {(a[b]);};(x[0]);"},
+		{"var f = func(x) { x * 2 }; var g = func(y) { f(y) - 1 }", "var f = func (x) {(x*2);};var g = func (y) {((y*2)-1);};"},
+		{"var f = func(x) { x + 1 }; var g = func(x) { x - 1 }; f(g(1))", "var f = func (x) {(x+1);};var g = func (x) {(x-1);};1;"},
+		// Unknown values of the arguments.
+		{"var f = func(x) { x + 1 }; f(g(1))", "var f = func (x) {(x+1);};f(g(1));"},
+		{"var f = func(x) { x + 1 }; f(1, 2)", "var f = func (x) {(x+1);};f(1, 2);"},
+		// Parameters used out of order, twice or not at all.
+		{"var f = func(a, b) { b - a }; f(1, 2)", "var f = func (a, b) {(b-a);};f(1, 2);"},
+		{"var f = func(x) { x * x }; f(2)", "var f = func (x) {(x*x);};f(2);"},
+		{"var f = func(x) { 1 }; f(2)", "var f = func (x) {1;};f(2);"},
+		// Bodies that are not simple expressions.
+		{"var f = func(x) { g(x) }; f(2)", "var f = func (x) {g(x);};f(2);"},
+		{"var f = func(x) { y + x }; f(2)", "var f = func (x) {(y+x);};f(2);"},
+		{"var f = func(x) { x && true }; f(a)", "var f = func (x) {(x&&true);};f(a);"},
+		{"var f = func(x) { var y = x; y }; f(2)", "var f = func (x) {var y = x;y;};f(2);"},
+		// Functions that may not be defined or may change.
+		{"f(2); var f = func(x) { x + 1 }", "f(2);var f = func (x) {(x+1);};"},
+		{"var f = func(x) { x + 1 }; f = g; f(2)", "var f = func (x) {(x+1);};f = g;f(2);"},
+		{"var f = func(x) { x + 1 }; if (c) { var f = 1 }; f(2)", "var f = func (x) {(x+1);};if (c) {var f = 1;};f(2);"},
+		{"var f = func(x) { x + 1 }; var g = func(f) { f(2) }", "var f = func (x) {(x+1);};var g = func (f) {f(2);};"},
+		{"if (c) { var f = func(x) { x + 1 } }; f(2)", "if (c) {var f = func (x) {(x+1);};};f(2);"},
+	})
+}
+
+// TestOptimize checks that optimized programs produce the same results and
+// errors as the original ones.
+func TestOptimize(t *testing.T) {
+	tests := []string{
+		"60 * 60 * 24",
+		`"a" + "b"`,
+		"var f = func(x) { x * 2 }; var g = func(n) { f(n) + f(3) }; g(4)",
+		"var f = func(a, b) { a[b] }; f([1, 2], 5)",
+		"var x = 0; if (1 > 2) { x = 1 } else { x = 2 }; x",
+		"var f = func(n) { if (true) { return n }; 0 }; f(5)",
+		"var n = 0; while (true) { n = n + 1; if (n > 3) { break } }; n",
+		"if (false) { 1 }",
+		"-(1 / 0)",
+		"true && 1",
+		"false || if (true) { 1 } else { 2 }",
+		"var f = func(x) { x + 1 }; if (f(1)) { 1 }",
+	}
+	for _, test := range tests {
+		expected, expectedErr := evaluator.NewInterpreter().Eval(test)
+		program, err := evaluator.Parse("", test)
+		if err != nil {
+			t.Fatalf("parse %q: %v", test, err)
+		}
+		Optimize(program)
+		got, err := evaluator.NewInterpreter().Run(program)
+		if (err == nil) != (expectedErr == nil) {
+			t.Errorf("optimized %q: expect error %v; got %v", test, expectedErr, err)
+			continue
+		}
+		if err != nil {
+			if err.Error() != expectedErr.Error() {
+				t.Errorf("optimized %q: expect error %v; got %v", test, expectedErr, err)
+			}
+			continue
+		}
+		if got.String() != expected.String() {
+			t.Errorf("optimized %q: expect %v; got %v", test, expected, got)
+		}
+	}
+}
+
+func TestInlinedError(t *testing.T) {
+	program, err := evaluator.Parse("", "var f = func(x) { x / 0 }; f(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Optimize(program)
+	_, err = evaluator.NewInterpreter().Run(program)
+	expected := "1:28: divide by zero"
+	if err == nil || evaluator.Traceback(err) != expected {
+		t.Errorf("expect error %q; got %v", expected, err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, p := range DefaultPasses {
+		got, ok := Lookup(p.Name())
+		if !ok || got != p {
+			t.Errorf("Lookup(%q): expect %v; got %v, %v", p.Name(), p, got, ok)
+		}
+	}
+	if _, ok := Lookup("unknown"); ok {
+		t.Errorf("Lookup(%q) succeeded", "unknown")
+	}
+}
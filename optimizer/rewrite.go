@@ -0,0 +1,99 @@
+package optimizer
+
+import "github.com/wangkekekexili/mankey/ast"
+
+// rewrite replaces every expression e in the tree rooted at node by f(e),
+// after the children of e have been rewritten. The targets of assignments
+// and the variables of var statements, for-in loops and functions are not
+// replaced, but the expressions inside them are. node itself is never
+// replaced.
+func rewrite(node ast.Node, f func(ast.Expression) ast.Expression) {
+	rewriter(f).statement(node)
+}
+
+type rewriter func(ast.Expression) ast.Expression
+
+func (r rewriter) statement(stat ast.Statement) {
+	switch n := stat.(type) {
+	case *ast.Program:
+		r.statements(n.Statements)
+	case *ast.BlockStatement:
+		r.block(n)
+	case *ast.VarStatement:
+		n.Value = r.expression(n.Value)
+	case *ast.ReturnStatement:
+		n.Value = r.expression(n.Value)
+	case *ast.AssignStatement:
+		if target, ok := n.Target.(*ast.IndexExpression); ok {
+			target.Left = r.expression(target.Left)
+			target.Index = r.expression(target.Index)
+		}
+		n.Value = r.expression(n.Value)
+	case *ast.WhileStatement:
+		n.Condition = r.expression(n.Condition)
+		r.block(n.Body)
+	case *ast.ForStatement:
+		r.statement(n.Init)
+		n.Condition = r.expression(n.Condition)
+		r.statement(n.Post)
+		r.block(n.Body)
+	case *ast.ForInStatement:
+		n.Iterable = r.expression(n.Iterable)
+		r.block(n.Body)
+	case *ast.ExpressionStatement:
+		n.Value = r.expression(n.Value)
+	case *ast.BreakStatement, *ast.ContinueStatement:
+	default:
+		r.expression(n)
+	}
+}
+
+func (r rewriter) statements(stats []ast.Statement) {
+	for _, stat := range stats {
+		r.statement(stat)
+	}
+}
+
+func (r rewriter) block(block *ast.BlockStatement) {
+	if block != nil {
+		r.statements(block.Statements)
+	}
+}
+
+func (r rewriter) expressions(exprs []ast.Expression) {
+	for i, e := range exprs {
+		exprs[i] = r.expression(e)
+	}
+}
+
+func (r rewriter) expression(expr ast.Expression) ast.Expression {
+	switch n := expr.(type) {
+	case nil:
+		return nil
+	case *ast.Array:
+		r.expressions(n.Elements)
+	case *ast.Hash:
+		for i, p := range n.Pairs {
+			n.Pairs[i].Key = r.expression(p.Key)
+			n.Pairs[i].Value = r.expression(p.Value)
+		}
+	case *ast.IndexExpression:
+		n.Left = r.expression(n.Left)
+		n.Index = r.expression(n.Index)
+	case *ast.PrefixExpression:
+		n.Value = r.expression(n.Value)
+	case *ast.InfixExpression:
+		n.Left = r.expression(n.Left)
+		n.Right = r.expression(n.Right)
+	case *ast.IfExpression:
+		n.Condition = r.expression(n.Condition)
+		r.block(n.Consequence)
+		r.block(n.Alternative)
+	case *ast.Function:
+		r.block(n.Body)
+	case *ast.CallExpression:
+		n.Function = r.expression(n.Function)
+		r.expressions(n.Arguments)
+	}
+	return r(expr)
+}
@@ -2,31 +2,124 @@ package parser
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/wangkekekexili/mankey/ast"
 	"github.com/wangkekekexili/mankey/token"
 )
 
-type errUnexpectedToken struct {
-	exp string
-	t   *token.Token
+// ErrorKind classifies a syntax error.
+type ErrorKind int
+
+const (
+	UnexpectedToken ErrorKind = iota + 1
+	NoPrefixParseFunction
+	NoInfixParseFunction
+	InvalidLiteral
+	Lexical // an error reported by the lexer
+	InvalidAssignment
+	BranchOutsideLoop // break or continue outside of a loop
+)
+
+var errorKindNames = map[ErrorKind]string{
+	UnexpectedToken:       "unexpected token",
+	NoPrefixParseFunction: "no prefix parse function",
+	NoInfixParseFunction:  "no infix parse function",
+	InvalidLiteral:        "invalid literal",
+	Lexical:               "lexical error",
+	InvalidAssignment:     "invalid assignment",
+	BranchOutsideLoop:     "branch outside loop",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// Error is a syntax error found while parsing.
+type Error struct {
+	Kind     ErrorKind
+	Pos      token.Position
+	Msg      string
+	Expected string       // description of what the parser expected, if any
+	Found    *token.Token // the offending token
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of syntax errors ordered by position.
+type ErrorList []*Error
+
+// Error returns all errors in the list, one per line.
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (l ErrorList) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Pos.Offset < l[j].Pos.Offset
+	})
+}
+
+func errUnexpectedToken(t *token.Token, exp string) *Error {
+	return &Error{
+		Kind:     UnexpectedToken,
+		Pos:      t.Pos,
+		Msg:      fmt.Sprintf("expect %v; got token %v", exp, t),
+		Expected: exp,
+		Found:    t,
+	}
 }
 
-func (e errUnexpectedToken) Error() string {
-	return fmt.Sprintf("expect %v; got token %v", e.exp, e.t)
+func errNoPrefixParseFunction(t *token.Token) *Error {
+	return &Error{
+		Kind:  NoPrefixParseFunction,
+		Pos:   t.Pos,
+		Msg:   fmt.Sprintf("no prefix parse function for %v", t),
+		Found: t,
+	}
 }
 
-type errNoPrefixParseFunction struct {
-	t *token.Token
+func errNoInfixParseFunction(t *token.Token) *Error {
+	return &Error{
+		Kind:  NoInfixParseFunction,
+		Pos:   t.Pos,
+		Msg:   fmt.Sprintf("no infix parse function for %v", t),
+		Found: t,
+	}
 }
 
-func (e errNoPrefixParseFunction) Error() string {
-	return fmt.Sprintf("no prefix parse function for %v", e.t)
+func errInvalidLiteral(t *token.Token, err error) *Error {
+	return &Error{
+		Kind:  InvalidLiteral,
+		Pos:   t.Pos,
+		Msg:   fmt.Sprintf("invalid literal %v: %v", t, err),
+		Found: t,
+	}
 }
 
-type errNoInfixParseFunction struct {
-	t *token.Token
+func errInvalidAssignment(target ast.Expression) *Error {
+	return &Error{
+		Kind: InvalidAssignment,
+		Pos:  target.Pos(),
+		Msg:  fmt.Sprintf("cannot assign to %v", target),
+	}
 }
 
-func (e errNoInfixParseFunction) Error() string {
-	return fmt.Sprintf("no infix parse function for %v", e.t)
+func errBranchOutsideLoop(t *token.Token) *Error {
+	return &Error{
+		Kind:  BranchOutsideLoop,
+		Pos:   t.Pos,
+		Msg:   fmt.Sprintf("%v outside loop", t.Literal),
+		Found: t,
+	}
 }
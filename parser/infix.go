@@ -14,9 +14,22 @@ func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, erro
 		return nil, err
 	}
 	infixExpression.Right = right
+	infixExpression.Span = p.span(left.Pos())
 	return infixExpression, nil
 }
 
+func (p *Parser) parseCallExpression(function ast.Expression) (ast.Expression, error) {
+	arguments, err := p.parseExpressionList(token.RParen)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.CallExpression{
+		Span:      p.span(function.Pos()),
+		Function:  function,
+		Arguments: arguments,
+	}, nil
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) (ast.Expression, error) {
 	indexExpression := &ast.IndexExpression{Left: left}
 
@@ -28,8 +41,9 @@ func (p *Parser) parseIndexExpression(left ast.Expression) (ast.Expression, erro
 	indexExpression.Index = index
 
 	if p.peekToken.Type != token.RBracket {
-		return nil, errUnexpectedToken{t: p.peekToken, exp: "]"}
+		return nil, errUnexpectedToken(p.peekToken, "]")
 	}
 	p.nextToken()
+	indexExpression.Span = p.span(left.Pos())
 	return indexExpression, nil
 }
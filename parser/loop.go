@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/token"
+)
+
+func (p *Parser) parseWhileStatement() (*ast.WhileStatement, error) {
+	whileStat := &ast.WhileStatement{}
+	start := p.currentToken.Pos
+
+	p.nextToken()
+	if p.currentToken.Type != token.LParen {
+		return nil, errUnexpectedToken(p.currentToken, "(")
+	}
+	p.nextToken()
+	expr, err := p.parseExpression(Lowest)
+	if err != nil {
+		return nil, err
+	}
+	whileStat.Condition = expr
+	p.nextToken()
+	if p.currentToken.Type != token.RParen {
+		return nil, errUnexpectedToken(p.currentToken, ")")
+	}
+
+	whileStat.Body, err = p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekToken.Type == token.Semicolon {
+		p.nextToken()
+	}
+
+	whileStat.Span = p.span(start)
+	return whileStat, nil
+}
+
+// parseForStatement parses both for (init; cond; post) { } and
+// for (x in iterable) { }.
+func (p *Parser) parseForStatement() (ast.Statement, error) {
+	start := p.currentToken.Pos
+
+	p.nextToken()
+	if p.currentToken.Type != token.LParen {
+		return nil, errUnexpectedToken(p.currentToken, "(")
+	}
+	p.nextToken()
+	if p.currentToken.Type == token.Ident && p.peekToken.Type == token.In {
+		return p.parseForInStatement(start)
+	}
+
+	forStat := &ast.ForStatement{}
+	var err error
+	if p.currentToken.Type != token.Semicolon {
+		if p.currentToken.Type == token.Var {
+			forStat.Init, err = p.parseVarStatement()
+		} else {
+			forStat.Init, err = p.parseExpressionStatement()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.currentToken.Type != token.Semicolon {
+			return nil, errUnexpectedToken(p.peekToken, ";")
+		}
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != token.Semicolon {
+		forStat.Condition, err = p.parseExpression(Lowest)
+		if err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		if p.currentToken.Type != token.Semicolon {
+			return nil, errUnexpectedToken(p.currentToken, ";")
+		}
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != token.RParen {
+		forStat.Post, err = p.parseExpressionStatement()
+		if err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		if p.currentToken.Type != token.RParen {
+			return nil, errUnexpectedToken(p.currentToken, ")")
+		}
+	}
+
+	forStat.Body, err = p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekToken.Type == token.Semicolon {
+		p.nextToken()
+	}
+
+	forStat.Span = p.span(start)
+	return forStat, nil
+}
+
+// parseForInStatement parses the rest of a for-in loop, with the loop
+// variable as the current token.
+func (p *Parser) parseForInStatement(start token.Position) (*ast.ForInStatement, error) {
+	forIn := &ast.ForInStatement{}
+	forIn.Variable = &ast.Identifier{Span: p.span(p.currentToken.Pos), Value: p.currentToken.Literal}
+
+	p.nextToken()
+	p.nextToken()
+	expr, err := p.parseExpression(Lowest)
+	if err != nil {
+		return nil, err
+	}
+	forIn.Iterable = expr
+	p.nextToken()
+	if p.currentToken.Type != token.RParen {
+		return nil, errUnexpectedToken(p.currentToken, ")")
+	}
+
+	forIn.Body, err = p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekToken.Type == token.Semicolon {
+		p.nextToken()
+	}
+
+	forIn.Span = p.span(start)
+	return forIn, nil
+}
+
+// parseLoopBody parses the block following the closing parenthesis of a loop
+// header, in which break and continue are allowed.
+func (p *Parser) parseLoopBody() (*ast.BlockStatement, error) {
+	p.nextToken()
+	if p.currentToken.Type != token.LBrace {
+		return nil, errUnexpectedToken(p.currentToken, "{")
+	}
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+// parseBranchStatement parses a break or continue statement.
+func (p *Parser) parseBranchStatement() (ast.Statement, error) {
+	t := p.currentToken
+	if p.loopDepth == 0 {
+		return nil, errBranchOutsideLoop(t)
+	}
+
+	if p.peekToken.Type == token.Semicolon {
+		p.nextToken()
+	}
+
+	if t.Type == token.Break {
+		return &ast.BreakStatement{Span: p.span(t.Pos)}, nil
+	}
+	return &ast.ContinueStatement{Span: p.span(t.Pos)}, nil
+}
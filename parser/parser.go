@@ -3,6 +3,7 @@ package parser
 import (
 	"github.com/wangkekekexili/mankey/ast"
 	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/resolver"
 	"github.com/wangkekekexili/mankey/token"
 )
 
@@ -14,6 +15,11 @@ type Parser struct {
 
 	prefixParseFnMap map[token.TokenType]prefixParseFn
 	infixParseFnMap  map[token.TokenType]infixParseFn
+
+	errors    ErrorList
+	lexErrors int // number of lexer errors already added to errors
+
+	loopDepth int // number of loops enclosing the current statement
 }
 
 func New(r *lexer.Lexer) *Parser {
@@ -23,6 +29,7 @@ func New(r *lexer.Lexer) *Parser {
 	p.prefixParseFnMap = map[token.TokenType]prefixParseFn{
 		token.Ident:    p.parseIdentifier,
 		token.Number:   p.parseInteger,
+		token.Float:    p.parseFloat,
 		token.String:   p.parseString,
 		token.Minus:    p.parsePrefixExpression,
 		token.Not:      p.parsePrefixExpression,
@@ -35,6 +42,8 @@ func New(r *lexer.Lexer) *Parser {
 		token.Func:     p.parseFunction,
 	}
 	p.infixParseFnMap = map[token.TokenType]infixParseFn{
+		token.And:      p.parseInfixExpression,
+		token.Or:       p.parseInfixExpression,
 		token.Equal:    p.parseInfixExpression,
 		token.NotEqual: p.parseInfixExpression,
 		token.Lt:       p.parseInfixExpression,
@@ -45,6 +54,7 @@ func New(r *lexer.Lexer) *Parser {
 		token.Minus:    p.parseInfixExpression,
 		token.Multiply: p.parseInfixExpression,
 		token.Divide:   p.parseInfixExpression,
+		token.LParen:   p.parseCallExpression,
 		token.LBracket: p.parseIndexExpression,
 	}
 
@@ -56,36 +66,110 @@ func New(r *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.r.NextToken()
+
+	lexErrors := p.r.Errors()
+	for _, e := range lexErrors[p.lexErrors:] {
+		p.addError(&Error{Kind: Lexical, Pos: e.Pos, Msg: e.Msg})
+	}
+	p.lexErrors = len(lexErrors)
+}
+
+// span returns the source range from start up to the end of the current token.
+func (p *Parser) span(start token.Position) ast.Span {
+	return ast.Span{Start: start, Stop: p.currentToken.End}
 }
 
+// ParseProgram parses the whole input. Syntax errors do not stop the parser:
+// it skips to the next statement and carries on, so that all errors can be
+// reported at once. When there are errors, the returned program contains the
+// statements that were parsed successfully and the error is an ErrorList.
 func (p *Parser) ParseProgram() (*ast.Program, error) {
 	program := &ast.Program{}
+	program.Start = p.currentToken.Pos
 	for p.currentToken.Type != token.EOF {
 		stat, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.addError(err)
+			p.synchronize()
+		} else {
+			program.Statements = append(program.Statements, stat)
 		}
-		program.Statements = append(program.Statements, stat)
 		p.nextToken()
 	}
+	program.Stop = p.currentToken.Pos
+	resolver.Resolve(program)
+	if len(p.errors) != 0 {
+		p.errors.sort()
+		return program, p.errors
+	}
 	return program, nil
 }
 
+func (p *Parser) addError(err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Pos: p.currentToken.Pos, Msg: err.Error(), Found: p.currentToken}
+	}
+	// An error often causes another one at the same place; keep the first.
+	for _, existing := range p.errors {
+		if existing.Pos == e.Pos {
+			return
+		}
+	}
+	p.errors = append(p.errors, e)
+}
+
+// synchronize skips tokens after a syntax error until a statement boundary:
+// a semicolon, the start of a var or return statement, or the closing brace
+// of the enclosing block, which is left as the current token.
+func (p *Parser) synchronize() {
+	depth := 0
+	for p.currentToken.Type != token.EOF {
+		switch p.currentToken.Type {
+		case token.LBrace:
+			depth++
+		case token.RBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.Semicolon:
+			if depth == 0 {
+				return
+			}
+		}
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.Var, token.Return, token.While, token.For, token.Break, token.Continue, token.RBrace, token.EOF:
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
 	block := &ast.BlockStatement{}
+	start := p.currentToken.Pos
 
 	p.nextToken()
 	for p.currentToken.Type != token.RBrace && p.currentToken.Type != token.EOF {
 		stat, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.addError(err)
+			p.synchronize()
+			if p.currentToken.Type == token.RBrace {
+				break
+			}
+		} else {
+			block.Statements = append(block.Statements, stat)
 		}
-		block.Statements = append(block.Statements, stat)
 		p.nextToken()
 	}
 	if p.currentToken.Type != token.RBrace {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: "}"}
+		return nil, errUnexpectedToken(p.currentToken, "}")
 	}
+	block.Span = p.span(start)
 	return block, nil
 }
 
@@ -95,6 +179,12 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 		return p.parseVarStatement()
 	case token.Return:
 		return p.parseReturnStatement()
+	case token.While:
+		return p.parseWhileStatement()
+	case token.For:
+		return p.parseForStatement()
+	case token.Break, token.Continue:
+		return p.parseBranchStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -102,17 +192,18 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 
 func (p *Parser) parseVarStatement() (*ast.VarStatement, error) {
 	varStat := &ast.VarStatement{}
+	start := p.currentToken.Pos
 
 	p.nextToken()
 	if p.currentToken.Type != token.Ident {
-		return nil, errUnexpectedToken{exp: "var statement", t: p.currentToken}
+		return nil, errUnexpectedToken(p.currentToken, "var statement")
 
 	}
-	varStat.Name = &ast.Identifier{Value: p.currentToken.Literal}
+	varStat.Name = &ast.Identifier{Span: p.span(p.currentToken.Pos), Value: p.currentToken.Literal}
 
 	p.nextToken()
 	if p.currentToken.Type != token.Assign {
-		return nil, errUnexpectedToken{exp: "=", t: p.currentToken}
+		return nil, errUnexpectedToken(p.currentToken, "=")
 	}
 
 	p.nextToken()
@@ -121,16 +212,21 @@ func (p *Parser) parseVarStatement() (*ast.VarStatement, error) {
 		return nil, err
 	}
 	varStat.Value = expr
+	if fn, ok := expr.(*ast.Function); ok {
+		fn.Name = varStat.Name.Value
+	}
 
 	if p.peekToken.Type == token.Semicolon {
 		p.nextToken()
 	}
 
+	varStat.Span = p.span(start)
 	return varStat, nil
 }
 
 func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 	returnStatement := &ast.ReturnStatement{}
+	start := p.currentToken.Pos
 
 	p.nextToken()
 	expr, err := p.parseExpression(Lowest)
@@ -143,26 +239,67 @@ func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 		p.nextToken()
 	}
 
+	returnStatement.Span = p.span(start)
 	return returnStatement, nil
 }
 
-func (p *Parser) parseExpressionStatement() (*ast.ExpressionStatement, error) {
+func (p *Parser) parseExpressionStatement() (ast.Statement, error) {
 	expressionStatement := &ast.ExpressionStatement{}
 	var err error
 	expressionStatement.Value, err = p.parseExpression(Lowest)
 	if err != nil {
 		return nil, err
 	}
+	if assignOperators[p.peekToken.Type] {
+		return p.parseAssignStatement(expressionStatement.Value)
+	}
 	if p.peekToken.Type == token.Semicolon {
 		p.nextToken()
 	}
+	expressionStatement.Span = p.span(expressionStatement.Value.Pos())
 	return expressionStatement, nil
 }
 
+var assignOperators = map[token.TokenType]bool{
+	token.Assign:    true,
+	token.AddAssign: true,
+	token.SubAssign: true,
+	token.MulAssign: true,
+	token.DivAssign: true,
+}
+
+// parseAssignStatement parses the rest of an assignment to target, with the
+// assignment operator as the peek token.
+func (p *Parser) parseAssignStatement(target ast.Expression) (*ast.AssignStatement, error) {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		return nil, errInvalidAssignment(target)
+	}
+	assignStat := &ast.AssignStatement{Target: target}
+
+	p.nextToken()
+	assignStat.Op = ast.Operator(p.currentToken.Literal)
+
+	p.nextToken()
+	expr, err := p.parseExpression(Lowest)
+	if err != nil {
+		return nil, err
+	}
+	assignStat.Value = expr
+
+	if p.peekToken.Type == token.Semicolon {
+		p.nextToken()
+	}
+
+	assignStat.Span = p.span(target.Pos())
+	return assignStat, nil
+}
+
 func (p *Parser) parseExpression(d precedence) (ast.Expression, error) {
 	prefixFn, ok := p.prefixParseFnMap[p.currentToken.Type]
 	if !ok {
-		return nil, errNoPrefixParseFunction{t: p.currentToken}
+		return nil, errNoPrefixParseFunction(p.currentToken)
 	}
 	expr, err := prefixFn()
 	if err != nil {
@@ -172,7 +309,7 @@ func (p *Parser) parseExpression(d precedence) (ast.Expression, error) {
 		p.nextToken()
 		infixFn, ok := p.infixParseFnMap[p.currentToken.Type]
 		if !ok {
-			return nil, errNoInfixParseFunction{t: p.currentToken}
+			return nil, errNoInfixParseFunction(p.currentToken)
 		}
 		expr, err = infixFn(expr)
 		if err != nil {
@@ -192,21 +329,21 @@ func (p *Parser) parseParameterList() ([]*ast.Identifier, error) {
 
 	p.nextToken()
 	if p.currentToken.Type != token.Ident {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: "identifier"}
+		return nil, errUnexpectedToken(p.currentToken, "identifier")
 	}
-	list = append(list, &ast.Identifier{Value: p.currentToken.Literal})
+	list = append(list, &ast.Identifier{Span: p.span(p.currentToken.Pos), Value: p.currentToken.Literal})
 
 	for p.peekToken.Type == token.Comma {
 		p.nextToken()
 		p.nextToken()
 		if p.currentToken.Type != token.Ident {
-			return nil, errUnexpectedToken{t: p.currentToken, exp: "identifier"}
+			return nil, errUnexpectedToken(p.currentToken, "identifier")
 		}
-		list = append(list, &ast.Identifier{Value: p.currentToken.Literal})
+		list = append(list, &ast.Identifier{Span: p.span(p.currentToken.Pos), Value: p.currentToken.Literal})
 	}
 
 	if p.peekToken.Type != token.RParen {
-		return nil, errUnexpectedToken{t: p.peekToken, exp: ")"}
+		return nil, errUnexpectedToken(p.peekToken, ")")
 	}
 	p.nextToken()
 
@@ -239,7 +376,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) ([]ast.Expression, err
 	}
 
 	if p.peekToken.Type != end {
-		return nil, errUnexpectedToken{t: p.peekToken, exp: string(end)}
+		return nil, errUnexpectedToken(p.peekToken, string(end))
 	}
 	p.nextToken()
 
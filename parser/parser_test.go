@@ -2,7 +2,11 @@ package parser
 
 import (
 	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
 	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/wangkekekexili/mankey/ast"
@@ -33,6 +37,151 @@ func TestString(t *testing.T) {
 	}
 }
 
+func TestStringLiteral(t *testing.T) {
+	tests := []struct {
+		value string
+		exp   string
+	}{
+		{"", `""`},
+		{"mankey", `"mankey"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`a\b`, `"a\\b"`},
+		{"a\tb\nc\r", `"a\tb\nc\r"`},
+		{"\x00\x7f\xff", `"\x00\x7f\xff"`},
+		{"héllo, 世界", `"héllo, 世界"`},
+		{"\u2028", `"\u{2028}"`},
+	}
+	for _, test := range tests {
+		got := (&ast.String{Value: test.value}).String()
+		if got != test.exp {
+			t.Errorf("got %v for %q; want %v", got, test.value, test.exp)
+		}
+		program, err := New(lexer.New(got)).ParseProgram()
+		if err != nil {
+			t.Errorf("parse %v: %v", got, err)
+			continue
+		}
+		s := program.Statements[0].(*ast.ExpressionStatement).Value.(*ast.String)
+		if s.Value != test.value {
+			t.Errorf("got value %q from %v; want %q", s.Value, got, test.value)
+		}
+	}
+}
+
+// TestStringRoundTrip checks that the text of every program in the tests of
+// this file, which are the string literals that parse without errors,
+// parses to an equivalent program with the same text, and that so does the
+// text of every expression in them.
+func TestStringRoundTrip(t *testing.T) {
+	file, err := goparser.ParseFile(gotoken.NewFileSet(), "parser_test.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	goast.Inspect(file, func(n goast.Node) bool {
+		if lit, ok := n.(*goast.BasicLit); ok && lit.Kind == gotoken.STRING {
+			code, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			codes = append(codes, code)
+		}
+		return true
+	})
+
+	programs := 0
+	for _, code := range codes {
+		program, err := New(lexer.New(code)).ParseProgram()
+		if err != nil {
+			continue
+		}
+		programs++
+		text := program.String()
+		again, err := New(lexer.New(text)).ParseProgram()
+		if err != nil {
+			t.Errorf("parse the text %q of %q: %v", text, code, err)
+			continue
+		}
+		if !equivalent(reflect.ValueOf(program), reflect.ValueOf(again)) {
+			t.Errorf("the text %q of %q parses to a different program", text, code)
+		}
+		if got := again.String(); got != text {
+			t.Errorf("the text %q of %q parses to a program with text %q", text, code, got)
+		}
+
+		ast.Inspect(program, func(n ast.Node) bool {
+			if !isExpression(n) {
+				return true
+			}
+			// The expression is parsed in a loop, where break and continue
+			// are allowed.
+			text := "while (true) {" + n.String() + ";}"
+			again, err := New(lexer.New(text)).ParseProgram()
+			if err != nil {
+				t.Errorf("parse the text %q of %T in %q: %v", text, n, code, err)
+				return true
+			}
+			if got := again.String(); got != text {
+				t.Errorf("the text %q of %T in %q parses to %q", text, n, code, got)
+			}
+			return true
+		})
+	}
+	if programs < 100 {
+		t.Fatalf("got %v programs in the tests; want at least 100", programs)
+	}
+}
+
+// isExpression tells whether n is an expression node.
+func isExpression(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.Program, *ast.BlockStatement, *ast.VarStatement, *ast.ReturnStatement,
+		*ast.AssignStatement, *ast.WhileStatement, *ast.ForStatement, *ast.ForInStatement,
+		*ast.BreakStatement, *ast.ContinueStatement, *ast.ExpressionStatement:
+		return false
+	}
+	return true
+}
+
+var spanType = reflect.TypeOf(ast.Span{})
+
+// equivalent tells whether the trees a and b are the same, except for the
+// positions of their nodes.
+func equivalent(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equivalent(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).Type == spanType {
+				continue
+			}
+			if !equivalent(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equivalent(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
+
 func TestVarStatement(t *testing.T) {
 	code := `
 var hello = 1;
@@ -99,6 +248,30 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		code     string
+		expValue float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9", 1e-9},
+		{"2.0", 2},
+	}
+	for _, test := range tests {
+		expressionStat, err := assertOneExpressionStatement(test.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, ok := expressionStat.Value.(*ast.Float)
+		if !ok {
+			t.Fatalf("expected to get a float; got %T", expressionStat.Value)
+		}
+		if f.Value != test.expValue {
+			t.Fatalf("got float %v; want %v", f.Value, test.expValue)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	code := `"hello world";`
 	expressionStat, err := assertOneExpressionStatement(code)
@@ -298,18 +471,85 @@ func TestParseOperatorPrecedence(t *testing.T) {
 				},
 			},
 		},
+		{
+			expr: "-f(x)[0]",
+			expExpression: &ast.PrefixExpression{
+				Op: "-",
+				Value: &ast.IndexExpression{
+					Left: &ast.CallExpression{
+						Function:  &ast.Identifier{Value: "f"},
+						Arguments: []ast.Expression{&ast.Identifier{Value: "x"}},
+					},
+					Index: &ast.Integer{Value: 0},
+				},
+			},
+		},
+		{
+			expr: "add(1)(2)",
+			expExpression: &ast.CallExpression{
+				Function: &ast.CallExpression{
+					Function:  &ast.Identifier{Value: "add"},
+					Arguments: []ast.Expression{&ast.Integer{Value: 1}},
+				},
+				Arguments: []ast.Expression{&ast.Integer{Value: 2}},
+			},
+		},
+		{
+			expr: "a * fns[1](b)",
+			expExpression: &ast.InfixExpression{
+				Left: &ast.Identifier{Value: "a"},
+				Op:   "*",
+				Right: &ast.CallExpression{
+					Function: &ast.IndexExpression{
+						Left:  &ast.Identifier{Value: "fns"},
+						Index: &ast.Integer{Value: 1},
+					},
+					Arguments: []ast.Expression{&ast.Identifier{Value: "b"}},
+				},
+			},
+		},
+		{
+			expr: "a || b && c == d",
+			expExpression: &ast.InfixExpression{
+				Left: &ast.Identifier{Value: "a"},
+				Op:   "||",
+				Right: &ast.InfixExpression{
+					Left: &ast.Identifier{Value: "b"},
+					Op:   "&&",
+					Right: &ast.InfixExpression{
+						Left:  &ast.Identifier{Value: "c"},
+						Op:    "==",
+						Right: &ast.Identifier{Value: "d"},
+					},
+				},
+			},
+		},
+		{
+			expr: "a && b || c",
+			expExpression: &ast.InfixExpression{
+				Left: &ast.InfixExpression{
+					Left:  &ast.Identifier{Value: "a"},
+					Op:    "&&",
+					Right: &ast.Identifier{Value: "b"},
+				},
+				Op:    "||",
+				Right: &ast.Identifier{Value: "c"},
+			},
+		},
 	}
 	for _, test := range tests {
 		gotProgram, err := New(lexer.New(test.expr + ";")).ParseProgram()
 		if err != nil {
 			t.Fatal(err)
 		}
+		clearSpans(gotProgram)
 		expProgram := &ast.Program{
 			Statements: []ast.Statement{
 				&ast.ExpressionStatement{
 					Value: test.expExpression,
 				},
 			},
+			Resolved: true,
 		}
 		if !reflect.DeepEqual(expProgram, gotProgram) {
 			t.Fatalf("expected to get %v; got %v", expProgram, gotProgram)
@@ -396,8 +636,8 @@ func TestFunctionParameters(t *testing.T) {
 	}
 	for _, test := range tests {
 		var expIdentifiers []*ast.Identifier
-		for _, para := range test.expParameters {
-			expIdentifiers = append(expIdentifiers, &ast.Identifier{Value: para})
+		for i, para := range test.expParameters {
+			expIdentifiers = append(expIdentifiers, &ast.Identifier{Value: para, Local: true, Slot: i})
 		}
 
 		expressionStat, err := assertOneExpressionStatement(test.code)
@@ -432,6 +672,35 @@ func TestCallExpression(t *testing.T) {
 	}
 }
 
+func TestCallArbitraryExpression(t *testing.T) {
+	tests := []struct {
+		code        string
+		expFunction string
+	}{
+		{"func(x) {x}(1)", "*ast.Function"},
+		{"(func(x) {x})(1)", "*ast.Function"},
+		{"add(1)(2)", "*ast.CallExpression"},
+		{"arr[0](x)", "*ast.IndexExpression"},
+		{`h["f"](x)`, "*ast.IndexExpression"},
+	}
+	for _, test := range tests {
+		expressionStat, err := assertOneExpressionStatement(test.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		call, ok := expressionStat.Value.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("expected to get a call expression; got %T", expressionStat.Value)
+		}
+		if got := fmt.Sprintf("%T", call.Function); got != test.expFunction {
+			t.Fatalf("got function %v; want %v", got, test.expFunction)
+		}
+		if len(call.Arguments) != 1 {
+			t.Fatalf("expected to get 1 argument; got %v", call.Arguments)
+		}
+	}
+}
+
 func TestCallArguments(t *testing.T) {
 	tests := []struct {
 		code         string
@@ -501,7 +770,7 @@ func TestHash_empty(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	var expExpr ast.Expression = &ast.Hash{Value: make(map[ast.Expression]ast.Expression)}
+	var expExpr ast.Expression = &ast.Hash{}
 	if !reflect.DeepEqual(gotExprStat.Value, expExpr) {
 		t.Fatalf("got expression %v; want %v", gotExprStat.Value, expExpr)
 	}
@@ -509,10 +778,13 @@ func TestHash_empty(t *testing.T) {
 
 func TestHash_stringKeyIntValue(t *testing.T) {
 	code := `{"one": 1, "two": 2, "three": 3}`
-	exp := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	exp := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
 	}
 
 	stat, err := assertOneExpressionStatement(code)
@@ -523,21 +795,137 @@ func TestHash_stringKeyIntValue(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected to get a hash; got %T", stat.Value)
 	}
-	got := make(map[string]int64)
-	for k, v := range hash.Value {
-		str, ok := k.(*ast.String)
+	if len(hash.Pairs) != len(exp) {
+		t.Fatalf("expect %v pairs; got %v", len(exp), len(hash.Pairs))
+	}
+	for i, p := range hash.Pairs {
+		str, ok := p.Key.(*ast.String)
 		if !ok {
-			t.Fatalf("expect key to be a string; got %T", k)
+			t.Fatalf("expect key to be a string; got %T", p.Key)
 		}
-		i, ok := v.(*ast.Integer)
-		if !ok {
-			t.Fatalf("expect value to be an int; got %T", v)
+		if str.Value != exp[i].key {
+			t.Fatalf("expect key %v to be %v; got %v", i, exp[i].key, str.Value)
+		}
+		if err := assertIntegerLiteral(p.Value, exp[i].value); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNodePosition(t *testing.T) {
+	program, err := New(lexer.NewFile("test.mk", "var a = 1;\nadd(a, 2 * b);")).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := program.Statements[1].(*ast.ExpressionStatement).Value.(*ast.CallExpression)
+	tests := []struct {
+		node     ast.Node
+		pos, end string
+	}{
+		{program, "test.mk:1:1", "test.mk:2:15"},
+		{program.Statements[0], "test.mk:1:1", "test.mk:1:11"},
+		{program.Statements[0].(*ast.VarStatement).Name, "test.mk:1:5", "test.mk:1:6"},
+		{program.Statements[1], "test.mk:2:1", "test.mk:2:15"},
+		{call, "test.mk:2:1", "test.mk:2:14"},
+		{call.Arguments[1], "test.mk:2:8", "test.mk:2:13"},
+	}
+	for _, test := range tests {
+		if test.node.Pos().String() != test.pos || test.node.End().String() != test.end {
+			t.Fatalf("got %v at %v-%v; want %v-%v", test.node, test.node.Pos(), test.node.End(), test.pos, test.end)
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		code   string
+		expErr string
+	}{
+		{"var a = 1;\nvar = 2;", "test.mk:2:5: expect var statement; got token [type='=';literal='=']"},
+		{"if (a) {\n  a\n", "test.mk:3:1: expect }; got token [type='EOF';literal='']"},
+		{"f(1, 2", "test.mk:1:7: expect ); got token [type='EOF';literal='']"},
+	}
+	for _, test := range tests {
+		_, err := New(lexer.NewFile("test.mk", test.code)).ParseProgram()
+		if err == nil {
+			t.Fatalf("expected an error for %q", test.code)
+		}
+		if err.Error() != test.expErr {
+			t.Fatalf("got error %q; want %q", err, test.expErr)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	code := `var a = ;
+var b = 2;
+var f = func(x) {
+  x +;
+  return x
+};
+var = 3;
+f(b`
+	program, err := New(lexer.New(code)).ParseProgram()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected to get an ErrorList; got %T", err)
+	}
+	tests := []struct {
+		kind     ErrorKind
+		pos      string
+		expected string
+	}{
+		{NoPrefixParseFunction, "1:9", ""},
+		{NoPrefixParseFunction, "4:6", ""},
+		{UnexpectedToken, "7:5", "var statement"},
+		{UnexpectedToken, "8:4", ")"},
+	}
+	if len(errs) != len(tests) {
+		t.Fatalf("got %v errors; want %v:\n%v", len(errs), len(tests), errs)
+	}
+	for i, test := range tests {
+		if errs[i].Kind != test.kind || errs[i].Pos.String() != test.pos || errs[i].Expected != test.expected {
+			t.Fatalf("got error %v (%v, expected %q); want %v at %v (expected %q)",
+				errs[i], errs[i].Kind, errs[i].Expected, test.kind, test.pos, test.expected)
 		}
-		got[str.Value] = i.Value
 	}
 
-	if !reflect.DeepEqual(exp, got) {
-		t.Fatalf("expect %v; got %v", exp, got)
+	// The statements without errors are still returned.
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected to get 2 statements; got %v", program.Statements)
+	}
+	for i, name := range []string{"b", "f"} {
+		varStat, ok := program.Statements[i].(*ast.VarStatement)
+		if !ok || varStat.Name.Value != name {
+			t.Fatalf("expected statement %v to be var %v; got %v", i, name, program.Statements[i])
+		}
+	}
+	body := program.Statements[1].(*ast.VarStatement).Value.(*ast.Function).Body
+	if len(body.Statements) != 1 {
+		t.Fatalf("expected to get 1 statement in the function body; got %v", body)
+	}
+}
+
+func TestLexicalError(t *testing.T) {
+	_, err := New(lexer.New(`var s = "\q";`)).ParseProgram()
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected to get an ErrorList; got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Kind != Lexical || errs[0].Pos.String() != "1:10" {
+		t.Fatalf("expected to get a lexical error at 1:10; got %v", errs)
+	}
+
+	// Invalid tokens are reported once, by the lexer.
+	_, err = New(lexer.New("var a = 1 # 2;\nvar b = 12x;\nvar c = \"abc")).ParseProgram()
+	exp := `1:11: invalid character U+0023 '#'
+2:9: invalid number literal "12x"
+3:9: unterminated string`
+	if err == nil || err.Error() != exp {
+		t.Fatalf("got error %q; want %q", err, exp)
 	}
 }
 
@@ -549,6 +937,7 @@ func assertOneExpressionStatement(code string) (*ast.ExpressionStatement, error)
 	if p == nil || len(p.Statements) != 1 {
 		return nil, fmt.Errorf("expect to get 1 statement; got %v", p)
 	}
+	clearSpans(p)
 	expressionStatement, ok := p.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		return nil, fmt.Errorf("expect to get an expression statement; got %T", p.Statements[0])
@@ -597,3 +986,173 @@ func assertBoolean(e ast.Expression, v bool) error {
 	}
 	return nil
 }
+
+// clearSpans zeroes all source positions recorded in v so that parsed trees
+// can be compared with trees built by hand.
+func clearSpans(v interface{}) {
+	clearSpansValue(reflect.ValueOf(v))
+}
+
+func clearSpansValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			clearSpansValue(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearSpansValue(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			clearSpansValue(k)
+			clearSpansValue(v.MapIndex(k))
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(ast.Span{}) {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			clearSpansValue(v.Field(i))
+		}
+	}
+}
+
+func TestAssignStatement(t *testing.T) {
+	tests := []struct {
+		code      string
+		expTarget string
+		expOp     ast.Operator
+		expValue  string
+	}{
+		{"x = 1;", "x", "=", "1"},
+		{"x += y * 2", "x", "+=", "(y*2)"},
+		{"x -= 1", "x", "-=", "1"},
+		{"x *= 1", "x", "*=", "1"},
+		{"x /= 1", "x", "/=", "1"},
+		{"arr[i + 1] = f(x)", "(arr[(i+1)])", "=", "f(x)"},
+		{`h["k"] += 1`, `(h["k"])`, "+=", "1"},
+	}
+	for _, test := range tests {
+		program, err := New(lexer.New(test.code)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("got %v statements; want 1", len(program.Statements))
+		}
+		stat, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("expect assign statement; got %T", program.Statements[0])
+		}
+		if stat.Target.String() != test.expTarget {
+			t.Fatalf("got target %v; want %v", stat.Target, test.expTarget)
+		}
+		if stat.Op != test.expOp {
+			t.Fatalf("got operator %v; want %v", stat.Op, test.expOp)
+		}
+		if stat.Value.String() != test.expValue {
+			t.Fatalf("got value %v; want %v", stat.Value, test.expValue)
+		}
+	}
+}
+
+func TestInvalidAssignment(t *testing.T) {
+	codes := []string{
+		"1 = 2",
+		"f() = 1",
+		"a + b += 1",
+	}
+	for _, code := range codes {
+		_, err := New(lexer.New(code)).ParseProgram()
+		errs, ok := err.(ErrorList)
+		if !ok {
+			t.Fatalf("expected an error list for %q; got %v", code, err)
+		}
+		if errs[0].Kind != InvalidAssignment {
+			t.Fatalf("got error kind %v for %q; want %v", errs[0].Kind, code, InvalidAssignment)
+		}
+	}
+}
+
+func TestLoopStatement(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"while (i < 10) { i += 1; }", "while ((i<10)) {i += 1;}"},
+		{"for (var i = 0; i < 10; i += 1) { puts(i); }", "for (var i = 0; (i<10); i += 1) {puts(i);}"},
+		{"for (i = 0; i < 10; i = i + 1) {}", "for (i = 0; (i<10); i = (i+1)) {}"},
+		{"for (;;) { break; }", "for (;;) {break;}"},
+		{"for (; x;) { continue }", "for (; x;) {continue;}"},
+		{"for (x in [1, 2]) { if (x == 1) { continue; } }", "for (x in [1,2]) {if ((x==1)) {continue;};}"},
+		{"while (true) { for (c in s) { break; } break; }", "while (true) {for (c in s) {break;}break;}"},
+	}
+	for _, test := range tests {
+		program, err := New(lexer.New(test.code)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("got %v statements; want 1", len(program.Statements))
+		}
+		if got := program.String(); got != test.exp {
+			t.Fatalf("got %q; want %q", got, test.exp)
+		}
+	}
+}
+
+func TestBranchOutsideLoop(t *testing.T) {
+	codes := []string{
+		"break;",
+		"continue",
+		"if (true) { break; }",
+		"while (true) { var f = func() { break; }; }",
+	}
+	for _, code := range codes {
+		_, err := New(lexer.New(code)).ParseProgram()
+		errs, ok := err.(ErrorList)
+		if !ok {
+			t.Fatalf("expected an error list for %q; got %v", code, err)
+		}
+		if errs[0].Kind != BranchOutsideLoop {
+			t.Fatalf("got error kind %v for %q; want %v", errs[0].Kind, code, BranchOutsideLoop)
+		}
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	code := `
+var f = func(n) {
+	g(n);
+	var h = func() { a(); b() };
+	if (n) { return c(); } else { d() }
+	while (true) { return e(); }
+	if (n) { i() } else { 1 + j() }
+};
+k()`
+	program, err := New(lexer.New(code)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expTail := map[string]bool{
+		"g": false, "a": false, "b": true, "c": true, "d": false,
+		"e": true, "i": true, "j": false, "k": false,
+	}
+	ast.Inspect(program, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		name := call.Function.String()
+		if call.Tail != expTail[name] {
+			t.Errorf("got tail %v for the call of %v; want %v", call.Tail, name, expTail[name])
+		}
+		delete(expTail, name)
+		return true
+	})
+	if len(expTail) != 0 {
+		t.Fatalf("calls not found: %v", expTail)
+	}
+}
@@ -6,6 +6,8 @@ type precedence int
 
 const (
 	Lowest precedence = iota + 1
+	LogicalOr
+	LogicalAnd
 	Equal
 	LteGte
 	Add
@@ -16,6 +18,8 @@ const (
 )
 
 var precedences = map[token.TokenType]precedence{
+	token.Or:       LogicalOr,
+	token.And:      LogicalAnd,
 	token.Equal:    Equal,
 	token.NotEqual: Equal,
 	token.Lt:       LteGte,
@@ -26,6 +30,7 @@ var precedences = map[token.TokenType]precedence{
 	token.Minus:    Add,
 	token.Multiply: Multi,
 	token.Divide:   Multi,
+	token.LParen:   Call,
 	token.LBracket: Index,
 }
 
@@ -8,49 +8,47 @@ import (
 )
 
 func (p *Parser) parseIdentifier() (ast.Expression, error) {
-	ident := &ast.Identifier{Value: p.currentToken.Literal}
-	if p.peekToken.Type != token.LParen {
-		return ident, nil
-	}
-	p.nextToken()
-	arguments, err := p.parseExpressionList(token.RParen)
-	if err != nil {
-		return nil, err
-	}
-	return &ast.CallExpression{
-		Function:  ident,
-		Arguments: arguments,
-	}, nil
+	return &ast.Identifier{Span: p.span(p.currentToken.Pos), Value: p.currentToken.Literal}, nil
 }
 
 func (p *Parser) parseBoolean() (ast.Expression, error) {
 	v, err := strconv.ParseBool(p.currentToken.Literal)
 	if err != nil {
-		return nil, err
+		return nil, errInvalidLiteral(p.currentToken, err)
 	}
-	return &ast.Boolean{Value: v}, nil
+	return &ast.Boolean{Span: p.span(p.currentToken.Pos), Value: v}, nil
 }
 
 func (p *Parser) parseInteger() (ast.Expression, error) {
 	v, err := strconv.ParseInt(p.currentToken.Literal, 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, errInvalidLiteral(p.currentToken, err)
+	}
+	return &ast.Integer{Span: p.span(p.currentToken.Pos), Value: v}, nil
+}
+
+func (p *Parser) parseFloat() (ast.Expression, error) {
+	v, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		return nil, errInvalidLiteral(p.currentToken, err)
 	}
-	return &ast.Integer{Value: v}, nil
+	return &ast.Float{Span: p.span(p.currentToken.Pos), Value: v}, nil
 }
 
 func (p *Parser) parseString() (ast.Expression, error) {
-	return &ast.String{Value: p.currentToken.Literal}, nil
+	return &ast.String{Span: p.span(p.currentToken.Pos), Value: p.currentToken.Literal}, nil
 }
 
 func (p *Parser) parsePrefixExpression() (ast.Expression, error) {
 	prefixExpression := &ast.PrefixExpression{Op: ast.Operator(p.currentToken.Literal)}
+	start := p.currentToken.Pos
 	p.nextToken()
 	expr, err := p.parseExpression(Prefix)
 	if err != nil {
 		return nil, err
 	}
 	prefixExpression.Value = expr
+	prefixExpression.Span = p.span(start)
 	return prefixExpression, nil
 }
 
@@ -61,7 +59,7 @@ func (p *Parser) parseGroupedExpression() (ast.Expression, error) {
 		return nil, err
 	}
 	if p.peekToken.Type != token.RParen {
-		return nil, errUnexpectedToken{t: p.peekToken, exp: ")"}
+		return nil, errUnexpectedToken(p.peekToken, ")")
 	}
 	p.nextToken()
 	return expr, nil
@@ -69,10 +67,11 @@ func (p *Parser) parseGroupedExpression() (ast.Expression, error) {
 
 func (p *Parser) parseIfExpression() (ast.Expression, error) {
 	ifExpression := &ast.IfExpression{}
+	start := p.currentToken.Pos
 
 	p.nextToken()
 	if p.currentToken.Type != token.LParen {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: "("}
+		return nil, errUnexpectedToken(p.currentToken, "(")
 	}
 	p.nextToken()
 	expr, err := p.parseExpression(Lowest)
@@ -82,12 +81,12 @@ func (p *Parser) parseIfExpression() (ast.Expression, error) {
 	ifExpression.Condition = expr
 	p.nextToken()
 	if p.currentToken.Type != token.RParen {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: ")"}
+		return nil, errUnexpectedToken(p.currentToken, ")")
 	}
 
 	p.nextToken()
 	if p.currentToken.Type != token.LBrace {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: "{"}
+		return nil, errUnexpectedToken(p.currentToken, "{")
 	}
 	block, err := p.parseBlockStatement()
 	if err != nil {
@@ -99,7 +98,7 @@ func (p *Parser) parseIfExpression() (ast.Expression, error) {
 		p.nextToken()
 		p.nextToken()
 		if p.currentToken.Type != token.LBrace {
-			return nil, errUnexpectedToken{t: p.currentToken, exp: "{"}
+			return nil, errUnexpectedToken(p.currentToken, "{")
 		}
 		block, err := p.parseBlockStatement()
 		if err != nil {
@@ -108,15 +107,17 @@ func (p *Parser) parseIfExpression() (ast.Expression, error) {
 		ifExpression.Alternative = block
 	}
 
+	ifExpression.Span = p.span(start)
 	return ifExpression, nil
 }
 
 func (p *Parser) parseFunction() (ast.Expression, error) {
 	function := &ast.Function{}
+	start := p.currentToken.Pos
 
 	p.nextToken()
 	if p.currentToken.Type != token.LParen {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: "("}
+		return nil, errUnexpectedToken(p.currentToken, "(")
 	}
 	list, err := p.parseParameterList()
 	if err != nil {
@@ -126,18 +127,25 @@ func (p *Parser) parseFunction() (ast.Expression, error) {
 
 	p.nextToken()
 	if p.currentToken.Type != token.LBrace {
-		return nil, errUnexpectedToken{t: p.currentToken, exp: "{"}
+		return nil, errUnexpectedToken(p.currentToken, "{")
 	}
+	// break and continue cannot jump out of a function body.
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	function.Body, err = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 	if err != nil {
 		return nil, err
 	}
+	markTailCalls(function.Body)
 
+	function.Span = p.span(start)
 	return function, nil
 }
 
 func (p *Parser) parseArray() (ast.Expression, error) {
 	arr := &ast.Array{}
+	start := p.currentToken.Pos
 
 	list, err := p.parseExpressionList(token.RBracket)
 	if err != nil {
@@ -145,14 +153,17 @@ func (p *Parser) parseArray() (ast.Expression, error) {
 	}
 	arr.Elements = list
 
+	arr.Span = p.span(start)
 	return arr, nil
 }
 
 func (p *Parser) parseHash() (ast.Expression, error) {
-	hash := &ast.Hash{Value: make(map[ast.Expression]ast.Expression)}
+	hash := &ast.Hash{}
+	start := p.currentToken.Pos
 
 	p.nextToken()
 	if p.currentToken.Type == token.RBrace {
+		hash.Span = p.span(start)
 		return hash, nil
 	}
 
@@ -164,7 +175,7 @@ func (p *Parser) parseHash() (ast.Expression, error) {
 
 		p.nextToken()
 		if p.currentToken.Type != token.Colon {
-			return nil, errUnexpectedToken{t: p.currentToken, exp: ":"}
+			return nil, errUnexpectedToken(p.currentToken, ":")
 		}
 		p.nextToken()
 		value, err := p.parseExpression(Lowest)
@@ -172,16 +183,17 @@ func (p *Parser) parseHash() (ast.Expression, error) {
 			return nil, err
 		}
 
-		hash.Value[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
 		p.nextToken()
 		if p.currentToken.Type == token.RBrace {
 			break
 		}
 		if p.currentToken.Type != token.Comma {
-			return nil, errUnexpectedToken{t: p.currentToken, exp: ","}
+			return nil, errUnexpectedToken(p.currentToken, ",")
 		}
 		p.nextToken()
 	}
+	hash.Span = p.span(start)
 	return hash, nil
 }
@@ -0,0 +1,39 @@
+package parser
+
+import "github.com/wangkekekexili/mankey/ast"
+
+// markTailCalls marks the calls in tail position in the body of a function:
+// the values of its return statements and its last expression, looking into
+// the branches of if expressions. Nested functions are marked when they are
+// parsed.
+func markTailCalls(body *ast.BlockStatement) {
+	markTailBlock(body)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Function:
+			return false
+		case *ast.ReturnStatement:
+			markTail(n.Value)
+		}
+		return true
+	})
+}
+
+func markTailBlock(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+	if stat, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+		markTail(stat.Value)
+	}
+}
+
+func markTail(expr ast.Expression) {
+	switch e := expr.(type) {
+	case *ast.CallExpression:
+		e.Tail = true
+	case *ast.IfExpression:
+		markTailBlock(e.Consequence)
+		markTailBlock(e.Alternative)
+	}
+}
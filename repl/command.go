@@ -0,0 +1,152 @@
+package repl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/evaluator"
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/parser"
+	"github.com/wangkekekexili/mankey/token"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(s *session, arg string)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"tokens": {":tokens <code>", "print the tokens of code", (*session).tokens},
+		"ast":    {":ast <code>", "print the syntax tree of code", (*session).ast},
+		"env":    {":env", "list the variables of the session", (*session).listEnv},
+		"reset":  {":reset", "forget all variables and history", (*session).reset},
+		"load":   {":load <file>", "evaluate a script in the session", (*session).load},
+		"save":   {":save <file>", "save the evaluated inputs as a script", (*session).save},
+		"help":   {":help", "show this help", (*session).help},
+	}
+}
+
+// command runs a line starting with a colon.
+func (s *session) command(line string) {
+	name, arg := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	c, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.w, "unknown command :%v; type :help for a list of commands\n", name)
+		return
+	}
+	c.run(s, arg)
+}
+
+func (s *session) tokens(code string) {
+	r := lexer.New(code)
+	r.SetMode(lexer.ScanComments)
+	for {
+		t := r.NextToken()
+		fmt.Fprintf(s.w, "%-8v %v\n", t.Pos, t)
+		if t.Type == token.EOF {
+			return
+		}
+	}
+}
+
+func (s *session) ast(code string) {
+	p, err := parser.New(lexer.New(code)).ParseProgram()
+	if err != nil {
+		fmt.Fprintln(s.w, err)
+		return
+	}
+	ast.FprintSyntax(s.w, p)
+}
+
+func (s *session) listEnv(string) {
+	env := s.in.Env()
+	for _, name := range env.Names() {
+		o, _ := env.Get(name)
+		fmt.Fprintf(s.w, "%v: %v = %v\n", name, o.Type(), o)
+	}
+}
+
+func (s *session) reset(string) {
+	s.in = evaluator.NewInterpreter()
+	s.in.Stdout = s.w
+	s.history = nil
+}
+
+func (s *session) load(filename string) {
+	if filename == "" {
+		fmt.Fprintln(s.w, "usage: :load <file>")
+		return
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(s.w, err)
+		return
+	}
+	v, err := s.eval(filename, string(src), evaluator.ParseFile)
+	if err != nil {
+		fmt.Fprintln(s.w, evaluator.Traceback(err))
+		return
+	}
+	fmt.Fprintln(s.w, v)
+}
+
+func (s *session) save(filename string) {
+	if filename == "" {
+		fmt.Fprintln(s.w, "usage: :save <file>")
+		return
+	}
+	var b strings.Builder
+	for _, input := range s.history {
+		b.WriteString(savedInput(input))
+		b.WriteString("\n")
+	}
+	if err := ioutil.WriteFile(filename, []byte(b.String()), 0644); err != nil {
+		fmt.Fprintln(s.w, err)
+		return
+	}
+	fmt.Fprintf(s.w, "saved %v inputs to %v\n", len(s.history), filename)
+}
+
+// savedInput returns input as :save writes it in a script: without its "#!"
+// line, which is only valid at the start of a file, and ending with a
+// semicolon, so that the next input does not continue its last statement.
+func savedInput(input string) string {
+	if strings.HasPrefix(input, "#!") {
+		input = input[strings.IndexByte(input+"\n", '\n'):]
+	}
+	input = strings.TrimSpace(input)
+	r := lexer.New(input)
+	var last *token.Token
+	for t := r.NextToken(); t.Type != token.EOF; t = r.NextToken() {
+		last = t
+	}
+	if last == nil || last.Type == token.Semicolon {
+		return input
+	}
+	// The semicolon goes before the comments after the last statement.
+	end := last.End.Offset
+	return input[:end] + ";" + input[end:]
+}
+
+func (s *session) help(string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.w, "  %-16v %v\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(s.w, "  %-16v %v\n", "exit", "leave the session")
+	fmt.Fprintf(s.w, "  %-16v %v\n", "(empty line)", "end an incomplete input")
+}
@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input, exp string
+	}{
+		{":tokens 1 + x\n", ">> 1:1      [type='NUMBER';literal='1']\n1:3      [type='+';literal='+']\n1:5      [type='IDENTIFIER';literal='x']\n1:6      [type='EOF';literal='']\n>> "},
+		{":ast 1\n", ">> Program 1:1-1:2\n  Statements: [1]\n    0: ExpressionStatement 1:1-1:2\n      Value: Integer 1:1-1:2\n        Value: 1\n>> "},
+		{":ast func(x) { f(x) }\n", ">> Program 1:1-1:17\n  Statements: [1]\n    0: ExpressionStatement 1:1-1:17\n      Value: Function 1:1-1:17\n        Name: \"\"\n        Parameters: [1]\n          0: Identifier 1:6-1:7\n            Value: \"x\"\n        Body: BlockStatement 1:9-1:17\n          Statements: [1]\n            0: ExpressionStatement 1:11-1:15\n              Value: CallExpression 1:11-1:15\n                Function: Identifier 1:11-1:12\n                  Value: \"f\"\n                Arguments: [1]\n                  0: Identifier 1:13-1:14\n                    Value: \"x\"\n>> "},
+		{":ast var\n", ">> 1:4: "},
+		{"var x = 1\nvar s = \"a\"\n:env\n", ">> 1\n>> a\n>> s: String = a\nx: INTEGER = 1\n>> "},
+		{"var x = 1\n:reset\n:env\nx\n", ">> 1\n>> >> >> 1:1: undefined identifier x\n>> "},
+		{":nope 1\n", ">> unknown command :nope; type :help for a list of commands\n>> "},
+		{":load\n:save\n", ">> usage: :load <file>\n>> usage: :save <file>\n>> "},
+		{":help\n", ">>   :ast <code>      print the syntax tree of code\n"},
+	}
+	for _, test := range tests {
+		if got := runSession(test.input); !strings.HasPrefix(got, test.exp) {
+			t.Errorf("session %q:\ngot\n%q\nwant\n%q...", test.input, got, test.exp)
+		}
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mankey-repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script, saved := filepath.Join(dir, "script.mk"), filepath.Join(dir, "saved.mk")
+	if err := ioutil.WriteFile(script, []byte("#!/usr/bin/env mankey\nvar y = x * 2;\ny + 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A loaded script, which may start with a "#!" line, runs in the session.
+	// Only the inputs that succeeded are saved.
+	got := runSession("var x = 3\nz\n:load " + script + "\ny\n:save " + saved + "\n")
+	exp := ">> 3\n>> 1:1: undefined identifier z\n>> 7\n>> 6\n>> saved 3 inputs to " + saved + "\n>> "
+	if got != exp {
+		t.Fatalf("got\n%q\nwant\n%q", got, exp)
+	}
+	src, err := ioutil.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "var x = 3;\nvar y = x * 2;\ny + 1;\ny;\n"; string(src) != exp {
+		t.Fatalf("saved %q; want %q", src, exp)
+	}
+
+	got = runSession(":load " + filepath.Join(dir, "missing.mk") + "\n")
+	if !strings.HasPrefix(got, ">> open ") {
+		t.Fatalf("got %q; want an error opening the file", got)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mankey-repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := filepath.Join(dir, "saved.mk")
+
+	// The saved inputs run the same way when they are loaded, even if an
+	// input starts with a prefix operator or ends with a comment.
+	got := runSession("var a = 5\n-a\nvar b = a // b\n[b]\n:save " + saved + "\n:reset\n:load " + saved + "\na + b\n")
+	exp := ">> 5\n>> -5\n>> 5\n>> [5]\n>> saved 4 inputs to " + saved + "\n>> >> [5]\n>> 10\n>> "
+	if got != exp {
+		t.Fatalf("got\n%q\nwant\n%q", got, exp)
+	}
+	src, err := ioutil.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "var a = 5;\n-a;\nvar b = a; // b\n[b];\n"; string(src) != exp {
+		t.Fatalf("saved %q; want %q", src, exp)
+	}
+}
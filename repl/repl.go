@@ -4,35 +4,140 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/wangkekekexili/mankey/ast"
 	"github.com/wangkekekexili/mankey/evaluator"
 	"github.com/wangkekekexili/mankey/lexer"
 	"github.com/wangkekekexili/mankey/object"
-	"github.com/wangkekekexili/mankey/parser"
+	"github.com/wangkekekexili/mankey/token"
 )
 
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+)
+
+// session holds the state of one interactive session.
+type session struct {
+	w  io.Writer
+	in *evaluator.Interpreter
+
+	// history records the inputs that were evaluated successfully, so that
+	// they can be saved as a script.
+	history []string
+}
+
 func Do(r io.Reader, w io.Writer) {
-	fmt.Fprintf(w, ">> ")
+	s := &session{w: w}
+	s.reset("")
+	fmt.Fprintf(w, prompt)
 	scanner := bufio.NewScanner(r)
-	env := object.NewEnvironment()
+	var lines []string
 	for scanner.Scan() {
 		text := scanner.Text()
-		if text == "exit" {
-			return
+		if len(lines) == 0 {
+			if text == "exit" {
+				return
+			}
+			if strings.HasPrefix(text, ":") {
+				s.command(text)
+				fmt.Fprintf(w, prompt)
+				continue
+			}
 		}
-		p, err := parser.New(lexer.New(text)).ParseProgram()
-		if err != nil {
-			fmt.Fprintln(w, err)
-			fmt.Fprintf(w, ">> ")
+		lines = append(lines, text)
+		input := strings.Join(lines, "\n")
+		// An empty line ends the input even if it is incomplete, so that a
+		// mistake such as an unterminated string is reported instead of
+		// taking all the following lines.
+		if text != "" && incomplete(input) {
+			fmt.Fprintf(w, continuationPrompt)
 			continue
 		}
-		v, err := evaluator.Eval(p, env)
+		lines = nil
+
+		v, err := s.eval("", input, evaluator.Parse)
 		if err != nil {
-			fmt.Fprintln(w, err)
-			fmt.Fprintf(w, ">> ")
-			continue
+			fmt.Fprintln(w, evaluator.Traceback(err))
+		} else {
+			fmt.Fprintln(w, v)
 		}
-		fmt.Fprintln(w, v)
-		fmt.Fprintf(w, ">> ")
+		fmt.Fprintf(w, prompt)
+	}
+}
+
+// eval evaluates input, parsed with parse, in the session environment and
+// records it in the history if it succeeds. Like the inputs of an
+// Interpreter, input may use globals that later inputs define.
+func (s *session) eval(filename, input string, parse func(filename, src string) (*ast.Program, error)) (object.Object, error) {
+	p, err := parse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.in.Run(p)
+	if err != nil {
+		return nil, err
+	}
+	s.history = append(s.history, input)
+	return v, nil
+}
+
+// continuationTokens are the tokens after which a statement cannot end.
+var continuationTokens = map[token.TokenType]bool{
+	token.Assign:    true,
+	token.AddAssign: true,
+	token.SubAssign: true,
+	token.MulAssign: true,
+	token.DivAssign: true,
+	token.Add:       true,
+	token.Minus:     true,
+	token.Divide:    true,
+	token.Multiply:  true,
+	token.Equal:     true,
+	token.Not:       true,
+	token.NotEqual:  true,
+	token.And:       true,
+	token.Or:        true,
+	token.Lt:        true,
+	token.Lte:       true,
+	token.Gt:        true,
+	token.Gte:       true,
+	token.Comma:     true,
+	token.Colon:     true,
+	token.Func:      true,
+	token.Var:       true,
+	token.If:        true,
+	token.Else:      true,
+	token.Return:    true,
+	token.While:     true,
+	token.For:       true,
+	token.In:        true,
+}
+
+// incomplete reports whether input needs more lines before it can be parsed:
+// it has unclosed brackets, ends with an operator or has an unterminated
+// string or comment.
+func incomplete(input string) bool {
+	r := lexer.New(input)
+	depth := 0
+	var last *token.Token
+	for t := r.NextToken(); t.Type != token.EOF; t = r.NextToken() {
+		switch t.Type {
+		case token.LParen, token.LBracket, token.LBrace:
+			depth++
+		case token.RParen, token.RBracket, token.RBrace:
+			depth--
+		}
+		last = t
+	}
+	for _, e := range r.Errors() {
+		if e.Kind == lexer.UnterminatedString || e.Kind == lexer.UnterminatedComment {
+			return true
+		}
+	}
+	if depth > 0 {
+		return true
 	}
+	return last != nil && continuationTokens[last.Type]
 }
@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input string
+		exp   bool
+	}{
+		{"", false},
+		{"1 + 2", false},
+		{"var f = func(x) { x }", false},
+		// Unclosed brackets.
+		{"var f = func(x) {", true},
+		{"if (x) {\n1\n} else {", true},
+		{"[1, 2", true},
+		{"{\"a\": 1", true},
+		{"f(1,\n2", true},
+		{"((1 + 2)", true},
+		{"f(1))", false},
+		// Unterminated strings and comments.
+		{`"abc`, true},
+		{"`raw\nstring", true},
+		{"/* a\nb", true},
+		{"1 /* a */", false},
+		{"1 // a {", false},
+		{`"{"`, false},
+		// Operators and keywords that need an operand.
+		{"1 +", true},
+		{"x ==", true},
+		{"var x =", true},
+		{"f(1,", true},
+		{"if (x) { 1 } else", true},
+		{"x += 1", false},
+		{"return", true},
+	}
+	for _, test := range tests {
+		if got := incomplete(test.input); got != test.exp {
+			t.Errorf("incomplete(%q) = %v; want %v", test.input, got, test.exp)
+		}
+	}
+}
+
+// runSession runs an interactive session with input, and returns its output.
+func runSession(input string) string {
+	var b strings.Builder
+	Do(strings.NewReader(input), &b)
+	return b.String()
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		input, exp string
+	}{
+		{"", ">> "},
+		{"1 + 2\n", ">> 3\n>> "},
+		{"x\n1\n", ">> 1:1: undefined identifier x\n>> 1\n>> "},
+		{"exit\n1\n", ">> "},
+		{`puts("hi")` + "\n", ">> hi\nNULL\n>> "},
+		// Incomplete input continues on the next lines.
+		{"var f = func(x) {\nx * 2\n}; f(\n3)\n", ">> .. .. .. 6\n>> "},
+		{"1 +\n2\n", ">> .. 3\n>> "},
+		// An empty line ends an incomplete input, which is reported.
+		{"\"abc\nexit\n\n1\n", ">> .. .. 1:1: unterminated string\n>> 1\n>> "},
+		{"var f = func() {\n\n:reset\nf\n", ">> .. 2:1: expect }; got token [type='EOF';literal='']\n>> >> 1:1: undefined identifier f\n>> "},
+		// Inputs may use the globals of later inputs.
+		{
+			"var isEven = func(n) { if (n == 0) { true } else { isOdd(n - 1) } }\n" +
+				"var isOdd = func(n) { if (n == 0) { false } else { isEven(n - 1) } }\n" +
+				"isEven(4)\n",
+			">> func(n){if ((n==0)) {true;} else {isOdd((n-1));};}\n" +
+				">> func(n){if ((n==0)) {false;} else {isEven((n-1));};}\n" +
+				">> true\n>> ",
+		},
+		// Lines are not script files: "#!" is invalid.
+		{"#!/usr/bin/env mankey\n", ">> 1:1: invalid character U+0023 '#'\n>> "},
+	}
+	for _, test := range tests {
+		if got := runSession(test.input); got != test.exp {
+			t.Errorf("session %q:\ngot\n%q\nwant\n%q", test.input, got, test.exp)
+		}
+	}
+}
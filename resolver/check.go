@@ -0,0 +1,143 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/token"
+)
+
+// Error reports an identifier that refers to an undefined variable, or to a
+// local used before its declaration.
+type Error struct {
+	Pos  token.Position
+	Name string
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of errors ordered by position.
+type ErrorList []*Error
+
+// Error returns all errors in the list, one per line.
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Check reports the identifiers in the tree rooted at node, which must have
+// been resolved, that refer to a global that is neither declared at the top
+// level of node nor defined according to defined, and those that refer to a
+// local of their own function before its first declaration in the source.
+// The error, if any, is an ErrorList.
+func Check(node ast.Node, defined func(name string) bool) error {
+	c := &checker{declared: make(map[string]bool), defined: defined, locals: map[string]int{}}
+	for _, name := range Declarations(node) {
+		c.declared[name] = true
+	}
+	ast.Inspect(node, c.visit)
+	if len(c.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		return c.errs[i].Pos.Offset < c.errs[j].Pos.Offset
+	})
+	return c.errs
+}
+
+type checker struct {
+	declared map[string]bool
+	defined  func(name string) bool
+
+	// locals maps the variables declared in the body of the function being
+	// checked, other than its parameters, to the offset from which they are
+	// set.
+	locals map[string]int
+
+	errs ErrorList
+}
+
+func (c *checker) visit(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.Function:
+		c.checkFunction(n)
+		return false
+	case *ast.VarStatement:
+		ast.Inspect(n.Value, c.visit)
+		return false
+	case *ast.ForInStatement:
+		ast.Inspect(n.Iterable, c.visit)
+		ast.Inspect(n.Body, c.visit)
+		return false
+	case *ast.AssignStatement:
+		if id, ok := n.Target.(*ast.Identifier); ok {
+			c.check(id, "assignment to undeclared variable %v")
+			ast.Inspect(n.Value, c.visit)
+			return false
+		}
+	case *ast.Identifier:
+		c.check(n, "undefined identifier %v")
+	}
+	return true
+}
+
+// checkFunction checks the body of fn, whose locals are set from the end of
+// their first var statement, or from the body of their first for-in loop.
+func (c *checker) checkFunction(fn *ast.Function) {
+	locals := make(map[string]int)
+	declare := func(name string, offset int) {
+		if _, ok := locals[name]; !ok {
+			locals[name] = offset
+		}
+	}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Function:
+			return false
+		case *ast.VarStatement:
+			declare(n.Name.Value, n.End().Offset)
+		case *ast.ForInStatement:
+			declare(n.Variable.Value, n.Body.Pos().Offset)
+		}
+		return true
+	})
+	for _, p := range fn.Parameters {
+		delete(locals, p.Value)
+	}
+
+	outer := c.locals
+	c.locals = locals
+	ast.Inspect(fn.Body, c.visit)
+	c.locals = outer
+}
+
+// check reports id with the message format if it is undefined, or if it is
+// used before its declaration.
+func (c *checker) check(id *ast.Identifier, format string) {
+	if id.Local {
+		if offset, ok := c.locals[id.Value]; ok && id.Depth == 0 && id.Pos().Offset < offset {
+			c.report(id, "variable %v used before its declaration")
+		}
+		return
+	}
+	if c.declared[id.Value] || c.defined(id.Value) {
+		return
+	}
+	c.report(id, format)
+}
+
+func (c *checker) report(id *ast.Identifier, format string) {
+	c.errs = append(c.errs, &Error{
+		Pos:  id.Pos(),
+		Name: id.Value,
+		Msg:  fmt.Sprintf(format, id.Value),
+	})
+}
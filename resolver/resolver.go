@@ -0,0 +1,106 @@
+// Package resolver binds the identifiers of a program to the variables they
+// refer to, and reports references to undefined variables, and to locals used
+// before their declaration, before the program runs.
+//
+// Blocks do not introduce scopes: the variables of a function are its
+// parameters and the variables declared anywhere in its body outside of
+// nested functions, and are stored in the slots of a frame created for each
+// call. The variables declared at the top level of a program are globals,
+// looked up by name, so that programs evaluated in the same environment can
+// share them.
+package resolver
+
+import (
+	"github.com/wangkekekexili/mankey/ast"
+)
+
+// Resolve binds the identifiers in the tree rooted at node, and sets the
+// number of slots of its functions. If node is a program, it is marked as
+// resolved. The parser resolves the programs it returns.
+func Resolve(node ast.Node) {
+	r := &resolver{}
+	r.resolve(node)
+	if p, ok := node.(*ast.Program); ok {
+		p.Resolved = true
+	}
+}
+
+// scope maps the variables of a function to their slots.
+type scope map[string]int
+
+type resolver struct {
+	scopes []scope // the functions enclosing the node being resolved, innermost last
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Function:
+			r.resolveFunction(n)
+			return false
+		case *ast.Identifier:
+			r.bind(n)
+		}
+		return true
+	})
+}
+
+func (r *resolver) resolveFunction(fn *ast.Function) {
+	s := make(scope)
+	for _, p := range fn.Parameters {
+		if _, ok := s[p.Value]; !ok {
+			s[p.Value] = len(s)
+		}
+	}
+	for _, name := range Declarations(fn.Body) {
+		if _, ok := s[name]; !ok {
+			s[name] = len(s)
+		}
+	}
+	fn.NumSlots = len(s)
+
+	r.scopes = append(r.scopes, s)
+	for _, p := range fn.Parameters {
+		r.bind(p)
+	}
+	r.resolve(fn.Body)
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// bind binds id to the variable of the innermost function that declares it,
+// or to a global.
+func (r *resolver) bind(id *ast.Identifier) {
+	for depth := 0; depth < len(r.scopes); depth++ {
+		if slot, ok := r.scopes[len(r.scopes)-1-depth][id.Value]; ok {
+			id.Local, id.Depth, id.Slot = true, depth, slot
+			return
+		}
+	}
+	id.Local, id.Depth, id.Slot = false, 0, 0
+}
+
+// Declarations returns the names of the variables declared by var statements
+// and for-in loops in body, outside of nested functions, in the order of
+// their declarations. body is the body of a function or a program.
+func Declarations(body ast.Node) []string {
+	var names []string
+	seen := make(map[string]bool)
+	declare := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Function:
+			return false
+		case *ast.VarStatement:
+			declare(n.Name.Value)
+		case *ast.ForInStatement:
+			declare(n.Variable.Value)
+		}
+		return true
+	})
+	return names
+}
@@ -0,0 +1,78 @@
+package resolver_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/parser"
+	"github.com/wangkekekexili/mankey/resolver"
+)
+
+func TestResolve(t *testing.T) {
+	code := `var g = 1;
+var f = func(a, b) {
+	var c = a + g;
+	func() { for (d in [b, c]) { d + a } }
+}`
+	program, err := parser.New(lexer.New(code)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bindings of the identifiers, in source order.
+	exp := []string{
+		"g global", "f global",
+		"a 0:0", "b 0:1",
+		"c 0:2", "a 0:0", "g global",
+		"d 0:0", "b 1:1", "c 1:2", "d 0:0", "a 1:0",
+	}
+	var got []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok {
+			if id.Local {
+				got = append(got, fmt.Sprintf("%v %v:%v", id.Value, id.Depth, id.Slot))
+			} else {
+				got = append(got, id.Value+" global")
+			}
+		}
+		return true
+	})
+	if fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Fatalf("got bindings\n%v\nwant\n%v", got, exp)
+	}
+
+	f := program.Statements[1].(*ast.VarStatement).Value.(*ast.Function)
+	if f.NumSlots != 3 {
+		t.Fatalf("got %v slots; want 3", f.NumSlots)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		code   string
+		expErr string
+	}{
+		{"var x = 1; x + y", "1:16: undefined identifier y"},
+		{"z = 1; var f = func() { z }", "1:1: assignment to undeclared variable z\n1:25: undefined identifier z"},
+		{"var f = func() { var z = 1 }; z", "1:31: undefined identifier z"},
+		{"defined + f(defined)", "1:11: undefined identifier f"},
+		{"var f = func() { h() }; var h = func() { f() }", ""},
+		{"var f = func() { defined; var defined = 1; func() { defined } }", "1:18: variable defined used before its declaration"},
+		{"var f = func(p) { p; var p = 1; for (i in [p]) { i } }", ""},
+	}
+	for _, test := range tests {
+		program, err := parser.New(lexer.New(test.code)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resolver.Check(program, func(name string) bool { return name == "defined" })
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.expErr {
+			t.Fatalf("%q: got error %q; want %q", test.code, got, test.expErr)
+		}
+	}
+}
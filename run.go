@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/compiler"
+	"github.com/wangkekekexili/mankey/evaluator"
+	"github.com/wangkekekexili/mankey/object"
+	"github.com/wangkekekexili/mankey/optimizer"
+	"github.com/wangkekekexili/mankey/resolver"
+	"github.com/wangkekekexili/mankey/vm"
+)
+
+// options are the flags of the mankey command that control how programs are
+// run.
+type options struct {
+	vm       bool // run programs with the virtual machine
+	optimize bool // optimize programs before running them
+	dumpAST  bool // write the tree of programs to stdout instead of running them
+}
+
+// evalSource parses and evaluates src with args bound to the global "args".
+// If printResult is set, a non-null result is written to stdout.
+func evalSource(filename, src string, args []string, printResult bool, opts options, stdout, stderr io.Writer) int {
+	if args == nil {
+		args = []string{}
+	}
+	// Only script files, which code given with -e is not, may start with a
+	// "#!" line.
+	parse := evaluator.Parse
+	if filename != "" {
+		parse = evaluator.ParseFile
+	}
+	program, err := parse(filename, src)
+	if err != nil {
+		fmt.Fprintln(stderr, evaluator.Traceback(err))
+		return exitError
+	}
+	if opts.optimize {
+		optimizer.Optimize(program)
+	}
+	if opts.dumpAST {
+		if err := ast.Fprint(stdout, program); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return exitOK
+	}
+	defined := func(name string) bool {
+		_, ok := evaluator.LookupBuiltin(name)
+		return ok || name == "args"
+	}
+	if err := resolver.Check(program, defined); err != nil {
+		fmt.Fprintln(stderr, evaluator.Traceback(err))
+		return exitError
+	}
+	run := evalInterpreter
+	if opts.vm {
+		run = evalVM
+	}
+	result, err := run(program, args, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, evaluator.Traceback(err))
+		return exitError
+	}
+	if printResult && result != object.Null {
+		fmt.Fprintln(stdout, result)
+	}
+	return exitOK
+}
+
+func evalInterpreter(program *ast.Program, args []string, stdout io.Writer) (object.Object, error) {
+	in := evaluator.NewInterpreter()
+	in.Stdout = stdout
+	if err := in.Set("args", args); err != nil {
+		return nil, err
+	}
+	return in.Run(program)
+}
+
+func evalVM(program *ast.Program, args []string, stdout io.Writer) (object.Object, error) {
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	argsObj, err := object.FromGo(args)
+	if err != nil {
+		return nil, err
+	}
+	m := vm.New(bytecode)
+	m.SetGlobal("args", argsObj)
+	return m.Run(evaluator.WithStdout(context.Background(), stdout))
+}
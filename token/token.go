@@ -7,9 +7,11 @@ type TokenType string
 const (
 	Illegal = "ILLEGAL"
 	EOF     = "EOF"
+	Comment = "COMMENT"
 
 	Ident  = "IDENTIFIER"
 	Number = "NUMBER"
+	Float  = "FLOAT"
 	String = "STRING"
 
 	Assign   = "="
@@ -18,10 +20,18 @@ const (
 	Divide   = "/"
 	Multiply = "*"
 
+	AddAssign = "+="
+	SubAssign = "-="
+	MulAssign = "*="
+	DivAssign = "/="
+
 	Equal    = "=="
 	Not      = "!"
 	NotEqual = "!="
 
+	And = "&&"
+	Or  = "||"
+
 	Lt  = "<"
 	Lte = "<="
 	Gt  = ">"
@@ -45,6 +55,12 @@ const (
 	If     = "if"
 	Else   = "else"
 	Return = "return"
+
+	While    = "while"
+	For      = "for"
+	In       = "in"
+	Break    = "break"
+	Continue = "continue"
 )
 
 var keywords = map[string]TokenType{
@@ -55,6 +71,12 @@ var keywords = map[string]TokenType{
 	"if":     If,
 	"else":   Else,
 	"return": Return,
+
+	"while":    While,
+	"for":      For,
+	"in":       In,
+	"break":    Break,
+	"continue": Continue,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -68,6 +90,9 @@ func LookupIdent(ident string) TokenType {
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	Pos Position // position of the first character of the token
+	End Position // position immediately after the token
 }
 
 func New(typ TokenType, literal string) *Token {
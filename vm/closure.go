@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"github.com/wangkekekexili/mankey/compiler"
+	"github.com/wangkekekexili/mankey/object"
+)
+
+// Closure is a function value: a compiled function with the variables it
+// captured from the functions enclosing it.
+type Closure struct {
+	Fn   *compiler.CompiledFunction
+	Free []*cell
+}
+
+func (c *Closure) Type() object.ObjectType {
+	return object.ObjFunction
+}
+
+func (c *Closure) String() string {
+	return c.Fn.String()
+}
+
+const (
+	objCell     = "CELL"
+	objIterator = "ITERATOR"
+)
+
+// cell holds a local captured by a closure, shared by the function that
+// declares it and the closures. Its value is nil until the local is set.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType {
+	return objCell
+}
+
+func (c *cell) String() string {
+	return objCell
+}
+
+// iterator is the state of a for-in loop.
+type iterator struct {
+	items []object.Object
+	next  int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return objIterator
+}
+
+func (it *iterator) String() string {
+	return objIterator
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/compiler"
+	"github.com/wangkekekexili/mankey/evaluator"
+)
+
+// The errors below are those the evaluator reports for the same nodes.
+
+// errorf returns a RuntimeError at the source position of node.
+func errorf(node ast.Node, format string, a ...interface{}) error {
+	return &evaluator.RuntimeError{
+		Node: node,
+		Pos:  node.Pos(),
+		Msg:  fmt.Sprintf(format, a...),
+	}
+}
+
+// limitError is like evaluator.NewLimitError, but node may be nil.
+func limitError(node ast.Node, kind evaluator.LimitKind, limit int64) error {
+	if node != nil {
+		return evaluator.NewLimitError(node, kind, limit)
+	}
+	l := &evaluator.LimitError{Kind: kind, Limit: limit}
+	return &evaluator.RuntimeError{Msg: l.Error(), Err: l}
+}
+
+// nodeBefore returns the node of the instruction at pc in fn or of the
+// closest instruction before it, to report an error at an instruction that
+// has no node.
+func nodeBefore(fn *compiler.CompiledFunction, pc int) ast.Node {
+	for ; pc >= 0; pc-- {
+		if node, ok := fn.Nodes[pc]; ok {
+			return node
+		}
+	}
+	if fn.Body != nil {
+		return fn.Body
+	}
+	return nil
+}
+
+// conditionError reports a condition that is not a boolean in node, an if
+// expression or a loop.
+func conditionError(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.IfExpression:
+		return errorf(node.Condition, "non-boolean value for the if expression")
+	case *ast.WhileStatement:
+		return errorf(node.Condition, "non-boolean value for the loop condition")
+	case *ast.ForStatement:
+		return errorf(node.Condition, "non-boolean value for the loop condition")
+	default:
+		return errorf(node, "non-boolean value for the condition")
+	}
+}
+
+func undefined(node ast.Node) error {
+	return errorf(node, "undefined identifier %v", node.(*ast.Identifier).Value)
+}
@@ -0,0 +1,656 @@
+// Package vm runs programs compiled by package compiler on a stack-based
+// virtual machine.
+//
+// A program run by the virtual machine has the same results and errors as
+// when it is evaluated by package evaluator, which is slower. The operations
+// on values are shared with the evaluator. The virtual machine differs in
+// that the step limit counts the instructions executed rather than the
+// nodes evaluated, and in that it does not check for undefined variables
+// before running a program; see resolver.Check.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/compiler"
+	"github.com/wangkekekexili/mankey/evaluator"
+	"github.com/wangkekekexili/mankey/object"
+)
+
+// VM runs a compiled program. The globals of the program persist across
+// runs.
+type VM struct {
+	// Limits bounds the resources used by each run.
+	Limits evaluator.Limits
+
+	main        *compiler.CompiledFunction
+	constants   []object.Object
+	globalNames []string
+	globals     []object.Object
+	builtins    []*object.Builtin // the builtins named like the globals, if any
+
+	stack  []object.Object
+	sp     int // the top of the stack is stack[sp-1]
+	frames []frame
+
+	ctx  context.Context
+	done <-chan struct{}
+}
+
+// frame is a function call in progress.
+type frame struct {
+	cl *Closure
+	ip int // offset of the next instruction of the caller, while it calls
+	bp int // offset of the locals on the stack
+}
+
+// New returns a virtual machine running bytecode, with the default limits.
+func New(bytecode *compiler.Bytecode) *VM {
+	vm := &VM{
+		Limits:      evaluator.DefaultLimits,
+		main:        bytecode.Main,
+		constants:   bytecode.Constants,
+		globalNames: bytecode.Globals,
+		globals:     make([]object.Object, len(bytecode.Globals)),
+		builtins:    make([]*object.Builtin, len(bytecode.Globals)),
+		stack:       make([]object.Object, 1024),
+	}
+	for i, name := range bytecode.Globals {
+		vm.builtins[i], _ = evaluator.LookupBuiltin(name)
+	}
+	return vm
+}
+
+// SetGlobal binds the global name to o. It returns false if the program does
+// not use name.
+func (vm *VM) SetGlobal(name string, o object.Object) bool {
+	for i, n := range vm.globalNames {
+		if n == name {
+			vm.globals[i] = o
+			return true
+		}
+	}
+	return false
+}
+
+// Global returns the value of the global name.
+func (vm *VM) Global(name string) (object.Object, bool) {
+	for i, n := range vm.globalNames {
+		if n == name && vm.globals[i] != nil {
+			return vm.globals[i], true
+		}
+	}
+	return nil, false
+}
+
+// Run runs the program and returns its value. It stops when ctx is done,
+// which is checked at every function call and loop iteration. The error, if
+// any, is an *evaluator.RuntimeError.
+func (vm *VM) Run(ctx context.Context) (object.Object, error) {
+	vm.ctx, vm.done = ctx, ctx.Done()
+	vm.sp = 0
+	vm.frames = append(vm.frames[:0], frame{cl: &Closure{Fn: vm.main}})
+	vm.ensureStack(0, vm.main.MaxStack)
+	o, err := vm.run()
+	for i := range vm.stack[:vm.sp] {
+		vm.stack[i] = nil
+	}
+	return o, err
+}
+
+func (vm *VM) run() (object.Object, error) {
+	fr := &vm.frames[len(vm.frames)-1]
+	bp := fr.bp
+	fn := fr.cl.Fn
+	ins := fn.Instructions
+	ip := 0
+	// The steps are counted against a limit that cannot be reached if there
+	// is none.
+	steps, maxSteps := int64(0), vm.Limits.MaxSteps
+	limit := maxSteps
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	// The stack and its top are kept in variables, and the top is stored
+	// back when the run ends.
+	stack, sp := vm.stack, vm.sp
+	defer func() { vm.sp = sp }()
+
+	for {
+		pc := ip
+		op := compiler.Opcode(ins[ip])
+		ip++
+		steps++
+		if steps > limit {
+			return nil, vm.fail(limitError(nodeBefore(fn, pc), evaluator.StepLimit, maxSteps))
+		}
+
+		switch op {
+		case compiler.OpConstant:
+			o := vm.constants[operand(ins, ip)]
+			ip += 2
+			if s, ok := o.(*object.String); ok {
+				if err := vm.Limits.CheckSize(fn.Nodes[pc], s); err != nil {
+					return nil, vm.fail(err)
+				}
+			}
+			stack[sp] = o
+			sp++
+		case compiler.OpNull:
+			stack[sp] = object.Null
+			sp++
+		case compiler.OpTrue:
+			stack[sp] = object.True
+			sp++
+		case compiler.OpFalse:
+			stack[sp] = object.False
+			sp++
+		case compiler.OpPop:
+			sp--
+			stack[sp] = nil
+		case compiler.OpPopN:
+			sp -= operand(ins, ip)
+			ip += 2
+		case compiler.OpDup:
+			stack[sp] = stack[sp-1]
+			sp++
+
+		case compiler.OpBinary:
+			operator := operand(ins, ip)
+			ip += 2
+			o, err := vm.binary(fn, pc, operator, stack[sp-2], stack[sp-1])
+			if err != nil {
+				return nil, vm.fail(err)
+			}
+			sp--
+			stack[sp] = nil
+			stack[sp-1] = o
+		case compiler.OpBinaryConst:
+			operator, right := operand(ins, ip), vm.constants[operand(ins, ip+2)]
+			ip += 4
+			o, err := vm.binary(fn, pc, operator, stack[sp-1], right)
+			if err != nil {
+				return nil, vm.fail(err)
+			}
+			stack[sp-1] = o
+		case compiler.OpLocalBinary:
+			operator, left, right := operand(ins, ip), stack[bp+operand(ins, ip+2)], vm.constants[operand(ins, ip+4)]
+			ip += 6
+			if left == nil {
+				return nil, vm.fail(undefined(fn.Nodes[pc].(*ast.InfixExpression).Left))
+			}
+			o, err := vm.binary(fn, pc, operator, left, right)
+			if err != nil {
+				return nil, vm.fail(err)
+			}
+			stack[sp] = o
+			sp++
+		case compiler.OpMinus, compiler.OpBang:
+			value := stack[sp-1]
+			var o object.Object
+			switch value := value.(type) {
+			case *object.Integer:
+				if op == compiler.OpMinus {
+					o = integer(-value.Value)
+				}
+			case *object.Boolean:
+				if op == compiler.OpBang {
+					o = nativeBoolean(!value.Value)
+				}
+			}
+			if o == nil {
+				var err error
+				o, err = evaluator.Prefix(fn.Nodes[pc].(*ast.PrefixExpression), value)
+				if err != nil {
+					return nil, vm.fail(err)
+				}
+			}
+			stack[sp-1] = o
+		case compiler.OpAnd, compiler.OpOr:
+			node := fn.Nodes[pc].(*ast.InfixExpression)
+			b, ok := stack[sp-1].(*object.Boolean)
+			if !ok {
+				return nil, vm.fail(errorf(node.Left, "'%v' only works on boolean values; got %v", node.Op, stack[sp-1]))
+			}
+			if b.Value == (op == compiler.OpOr) {
+				ip = operand(ins, ip)
+			} else {
+				ip += 2
+				sp--
+			}
+		case compiler.OpCheckLogical:
+			if _, ok := stack[sp-1].(*object.Boolean); !ok {
+				node := fn.Nodes[pc].(*ast.InfixExpression)
+				return nil, vm.fail(errorf(node.Right, "'%v' only works on boolean values; got %v", node.Op, stack[sp-1]))
+			}
+
+		case compiler.OpJump:
+			ip = operand(ins, ip)
+		case compiler.OpJumpIfFalse:
+			sp--
+			cond, ok := stack[sp].(*object.Boolean)
+			stack[sp] = nil
+			if !ok {
+				return nil, vm.fail(conditionError(fn.Nodes[pc]))
+			}
+			if cond.Value {
+				ip += 2
+			} else {
+				ip = operand(ins, ip)
+			}
+		case compiler.OpCheck:
+			if err := vm.check(fn, pc); err != nil {
+				return nil, vm.fail(err)
+			}
+
+		case compiler.OpGetGlobal:
+			i := operand(ins, ip)
+			ip += 2
+			o := vm.globals[i]
+			if o == nil {
+				if b := vm.builtins[i]; b != nil {
+					o = b
+				} else {
+					return nil, vm.fail(undefined(fn.Nodes[pc]))
+				}
+			}
+			stack[sp] = o
+			sp++
+		case compiler.OpSetGlobal:
+			sp--
+			vm.globals[operand(ins, ip)] = stack[sp]
+			stack[sp] = nil
+			ip += 2
+		case compiler.OpGetLocal:
+			o := stack[bp+operand(ins, ip)]
+			ip += 2
+			if o == nil {
+				return nil, vm.fail(undefined(fn.Nodes[pc]))
+			}
+			stack[sp] = o
+			sp++
+		case compiler.OpSetLocal:
+			sp--
+			stack[bp+operand(ins, ip)] = stack[sp]
+			stack[sp] = nil
+			ip += 2
+		case compiler.OpGetCell, compiler.OpGetFree:
+			var c *cell
+			if op == compiler.OpGetCell {
+				c = stack[bp+operand(ins, ip)].(*cell)
+			} else {
+				c = fr.cl.Free[operand(ins, ip)]
+			}
+			ip += 2
+			o := c.value
+			if o == nil {
+				return nil, vm.fail(undefined(fn.Nodes[pc]))
+			}
+			stack[sp] = o
+			sp++
+		case compiler.OpSetCell:
+			sp--
+			stack[bp+operand(ins, ip)].(*cell).value = stack[sp]
+			stack[sp] = nil
+			ip += 2
+		case compiler.OpSetFree:
+			sp--
+			fr.cl.Free[operand(ins, ip)].value = stack[sp]
+			stack[sp] = nil
+			ip += 2
+		case compiler.OpLoadCell:
+			stack[sp] = stack[bp+operand(ins, ip)]
+			sp++
+			ip += 2
+		case compiler.OpLoadFree:
+			stack[sp] = fr.cl.Free[operand(ins, ip)]
+			sp++
+			ip += 2
+		case compiler.OpAssignable:
+			scope, i := compiler.Scope(operand(ins, ip)), operand(ins, ip+2)
+			ip += 4
+			var o object.Object
+			switch scope {
+			case compiler.GlobalScope:
+				o = vm.globals[i]
+			case compiler.LocalScope:
+				o = stack[bp+i]
+			case compiler.CellScope:
+				o = stack[bp+i].(*cell).value
+			case compiler.FreeScope:
+				o = fr.cl.Free[i].value
+			}
+			if o == nil {
+				target := fn.Nodes[pc].(*ast.Identifier)
+				return nil, vm.fail(errorf(target, "assignment to undeclared variable %v", target.Value))
+			}
+			stack[sp] = o
+			sp++
+
+		case compiler.OpClosure:
+			constant, n := operand(ins, ip), operand(ins, ip+2)
+			ip += 4
+			cl := &Closure{Fn: vm.constants[constant].(*compiler.CompiledFunction)}
+			if n > 0 {
+				cl.Free = make([]*cell, n)
+				for i := range cl.Free {
+					cl.Free[i] = stack[sp-n+i].(*cell)
+					stack[sp-n+i] = nil
+				}
+				sp -= n
+			}
+			stack[sp] = cl
+			sp++
+		case compiler.OpCall, compiler.OpTailCall:
+			n := operand(ins, ip)
+			ip += 2
+			if vm.done != nil {
+				if err := vm.check(fn, pc); err != nil {
+					return nil, vm.fail(err)
+				}
+			}
+			switch callee := stack[sp-1-n].(type) {
+			case *Closure:
+				if len(callee.Fn.Parameters) != n {
+					return nil, vm.fail(errorf(fn.Nodes[pc], "function expects %v parameter; %v provided", len(callee.Fn.Parameters), n))
+				}
+				if op == compiler.OpTailCall && callee == fr.cl {
+					// The frame of the caller is reused; see evaluator.callFunction.
+					copy(stack[bp:], stack[sp-n:sp])
+					for i := bp + n; i < sp; i++ {
+						stack[i] = nil
+					}
+					sp = enter(stack, fr, n)
+					ip = 0
+					continue
+				}
+				if max := vm.Limits.MaxDepth; max > 0 && len(vm.frames)-1 >= max {
+					return nil, vm.fail(limitError(fn.Nodes[pc], evaluator.DepthLimit, int64(max)))
+				}
+				fr.ip = ip
+				vm.frames = append(vm.frames, frame{cl: callee, bp: sp - n})
+				fr = &vm.frames[len(vm.frames)-1]
+				bp = fr.bp
+				fn = callee.Fn
+				ins = fn.Instructions
+				ip = 0
+				if need := bp + fn.NumLocals + fn.MaxStack; need > len(stack) {
+					vm.ensureStack(sp, need)
+					stack = vm.stack
+				}
+				sp = enter(stack, fr, n)
+			case *object.Builtin:
+				node := fn.Nodes[pc].(*ast.CallExpression)
+				args := make([]object.Object, n)
+				copy(args, stack[sp-n:sp])
+				o, err := evaluator.CallBuiltin(vm.ctx, node, callee, args)
+				if err == nil {
+					err = vm.Limits.CheckSize(node, o)
+				}
+				if err != nil {
+					return nil, vm.fail(err)
+				}
+				sp = popN(stack, sp, n+1)
+				stack[sp] = o
+				sp++
+			default:
+				node := fn.Nodes[pc].(*ast.CallExpression)
+				return nil, vm.fail(errorf(node.Function, "unknown type of function %T", callee))
+			}
+		case compiler.OpReturnValue:
+			o := stack[sp-1]
+			if len(vm.frames) == 1 {
+				return o, nil
+			}
+			sp = popN(stack, sp, sp-bp+1)
+			stack[sp] = o
+			sp++
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			fr = &vm.frames[len(vm.frames)-1]
+			bp = fr.bp
+			fn = fr.cl.Fn
+			ins = fn.Instructions
+			ip = fr.ip
+
+		case compiler.OpArray:
+			n := operand(ins, ip)
+			ip += 2
+			arr := &object.Array{}
+			if n > 0 {
+				arr.Elements = make([]object.Object, n)
+				copy(arr.Elements, stack[sp-n:sp])
+			}
+			if err := vm.Limits.CheckSize(fn.Nodes[pc], arr); err != nil {
+				return nil, vm.fail(err)
+			}
+			sp = popN(stack, sp, n)
+			stack[sp] = arr
+			sp++
+		case compiler.OpHash:
+			n := operand(ins, ip)
+			ip += 2
+			h := object.NewHash()
+			for i := sp - 2*n; i < sp; i += 2 {
+				h.Set(stack[i], stack[i+1])
+			}
+			if err := vm.Limits.CheckSize(fn.Nodes[pc], h); err != nil {
+				return nil, vm.fail(err)
+			}
+			sp = popN(stack, sp, 2*n)
+			stack[sp] = h
+			sp++
+		case compiler.OpHashKey:
+			if _, ok := stack[sp-1].(object.HashKeyer); !ok {
+				return nil, vm.fail(errorf(fn.Nodes[pc], "cannot get hash key from %v", stack[sp-1]))
+			}
+		case compiler.OpIndex:
+			left, index := stack[sp-2], stack[sp-1]
+			var o object.Object
+			arr, ok := left.(*object.Array)
+			i, ok2 := index.(*object.Integer)
+			if ok && ok2 && i.Value >= 0 && i.Value < int64(len(arr.Elements)) {
+				o = arr.Elements[i.Value]
+			} else {
+				var err error
+				o, err = evaluator.Index(fn.Nodes[pc].(*ast.IndexExpression), left, index)
+				if err != nil {
+					return nil, vm.fail(err)
+				}
+			}
+			sp--
+			stack[sp] = nil
+			stack[sp-1] = o
+		case compiler.OpIndexCurrent:
+			node := fn.Nodes[pc].(*ast.AssignStatement)
+			left, index := stack[sp-2], stack[sp-1]
+			o, err := evaluator.IndexAssignable(node.Target.(*ast.IndexExpression), left, index)
+			if err == nil {
+				err = vm.Limits.CheckInsert(node, left, index)
+			}
+			if err != nil {
+				return nil, vm.fail(err)
+			}
+			stack[sp] = o
+			sp++
+		case compiler.OpSetIndex:
+			left, index, o := stack[sp-3], stack[sp-2], stack[sp-1]
+			evaluator.SetIndex(left, index, o)
+			sp = popN(stack, sp, 3)
+			stack[sp] = o
+			sp++
+
+		case compiler.OpIter:
+			items, err := evaluator.ForInItems(fn.Nodes[pc].(*ast.ForInStatement), stack[sp-1])
+			if err != nil {
+				return nil, vm.fail(err)
+			}
+			stack[sp-1] = &iterator{items: items}
+		case compiler.OpIterNext:
+			it := stack[sp-1].(*iterator)
+			if it.next < len(it.items) {
+				stack[sp] = it.items[it.next]
+				sp++
+				it.next++
+				ip += 2
+			} else {
+				sp--
+				stack[sp] = nil
+				ip = operand(ins, ip)
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+}
+
+// popN clears the n values on top of stack, below sp, and returns the new
+// top.
+func popN(stack []object.Object, sp, n int) int {
+	for i := sp - n; i < sp; i++ {
+		stack[i] = nil
+	}
+	return sp - n
+}
+
+// enter prepares the locals of the frame fr on stack, whose first n are set
+// to the arguments of the call, and returns the top of the stack.
+func enter(stack []object.Object, fr *frame, n int) int {
+	fn := fr.cl.Fn
+	top := fr.bp + fn.NumLocals
+	for i := fr.bp + n; i < top; i++ {
+		stack[i] = nil
+	}
+	for _, i := range fn.Cells {
+		stack[fr.bp+i] = &cell{value: stack[fr.bp+i]}
+	}
+	return top
+}
+
+// ensureStack grows the stack, whose top is sp, to at least n values.
+func (vm *VM) ensureStack(sp, n int) {
+	if n <= len(vm.stack) {
+		return
+	}
+	size := 2 * len(vm.stack)
+	if size < n {
+		size = n
+	}
+	stack := make([]object.Object, size)
+	copy(stack, vm.stack[:sp])
+	vm.stack = stack
+}
+
+// check returns an error if the run was canceled. pc is the offset of the
+// instruction being executed in fn.
+func (vm *VM) check(fn *compiler.CompiledFunction, pc int) error {
+	select {
+	case <-vm.done:
+		return evaluator.NewCanceledError(fn.Nodes[pc], vm.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// fail adds the calls in progress to err, which occurred in the innermost
+// one.
+func (vm *VM) fail(err error) error {
+	e, ok := err.(*evaluator.RuntimeError)
+	if !ok {
+		return err
+	}
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		caller := vm.frames[i-1]
+		call := caller.cl.Fn.Nodes[caller.ip-3]
+		name := vm.frames[i].cl.Fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		e.Frames = append(e.Frames, evaluator.Frame{Function: name, Pos: call.Pos()})
+	}
+	return e
+}
+
+func operand(ins compiler.Instructions, ip int) int {
+	return int(ins[ip])<<8 | int(ins[ip+1])
+}
+
+// smallIntegers are the integers from minSmallInteger on, shared by the
+// results of the operations instead of allocating them.
+var smallIntegers [1024]object.Integer
+
+const minSmallInteger = -128
+
+func init() {
+	for i := range smallIntegers {
+		smallIntegers[i].Value = int64(i + minSmallInteger)
+	}
+}
+
+// integer returns an integer object of value v.
+func integer(v int64) object.Object {
+	if i := v - minSmallInteger; i >= 0 && i < int64(len(smallIntegers)) {
+		return &smallIntegers[i]
+	}
+	return &object.Integer{Value: v}
+}
+
+func nativeBoolean(v bool) object.Object {
+	if v {
+		return object.True
+	}
+	return object.False
+}
+
+// binary applies operator to left and right for the instruction at pc in
+// fn.
+func (vm *VM) binary(fn *compiler.CompiledFunction, pc, operator int, left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			if o := binaryInteger(operator, l.Value, r.Value); o != nil {
+				return o, nil
+			}
+		}
+	}
+	node := fn.Nodes[pc]
+	o, err := evaluator.Infix(node, compiler.Operators[operator], left, right)
+	if err == nil {
+		err = vm.Limits.CheckSize(node, o)
+	}
+	return o, err
+}
+
+// binaryInteger applies operator to the values of integer operands. It
+// returns nil for a division by zero.
+func binaryInteger(operator int, l, r int64) object.Object {
+	switch operator {
+	case compiler.OperatorAdd:
+		return integer(l + r)
+	case compiler.OperatorSub:
+		return integer(l - r)
+	case compiler.OperatorMul:
+		return integer(l * r)
+	case compiler.OperatorDiv:
+		if r == 0 {
+			return nil
+		}
+		return integer(l / r)
+	case compiler.OperatorLT:
+		return nativeBoolean(l < r)
+	case compiler.OperatorLE:
+		return nativeBoolean(l <= r)
+	case compiler.OperatorGT:
+		return nativeBoolean(l > r)
+	case compiler.OperatorGE:
+		return nativeBoolean(l >= r)
+	case compiler.OperatorEQ:
+		return nativeBoolean(l == r)
+	case compiler.OperatorNE:
+		return nativeBoolean(l != r)
+	default:
+		return nil
+	}
+}
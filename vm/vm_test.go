@@ -0,0 +1,294 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wangkekekexili/mankey/ast"
+	"github.com/wangkekekexili/mankey/compiler"
+	"github.com/wangkekekexili/mankey/evaluator"
+	"github.com/wangkekekexili/mankey/evaluator/evaltest"
+	"github.com/wangkekekexili/mankey/lexer"
+	"github.com/wangkekekexili/mankey/object"
+	"github.com/wangkekekexili/mankey/parser"
+	"github.com/wangkekekexili/mankey/resolver"
+)
+
+func parse(t testing.TB, code string) *ast.Program {
+	program, err := parser.New(lexer.New(code)).ParseProgram()
+	if err != nil {
+		t.Fatalf("%q: %v", code, err)
+	}
+	return program
+}
+
+func run(t testing.TB, code string, limits evaluator.Limits) (object.Object, error) {
+	bytecode, err := compiler.Compile(parse(t, code))
+	if err != nil {
+		t.Fatalf("%q: %v", code, err)
+	}
+	vm := New(bytecode)
+	vm.Limits = limits
+	return vm.Run(context.Background())
+}
+
+// runChecked runs code like run with the default limits, after checking it
+// for undefined variables as the evaluator does.
+func runChecked(t testing.TB, code string) (object.Object, error) {
+	defined := func(name string) bool {
+		_, ok := evaluator.LookupBuiltin(name)
+		return ok
+	}
+	if err := resolver.Check(parse(t, code), defined); err != nil {
+		return nil, err
+	}
+	return run(t, code, evaluator.DefaultLimits)
+}
+
+// result returns the value or the traceback of the error of a program, to
+// compare the virtual machine with the evaluator.
+func result(o object.Object, err error) string {
+	if err != nil {
+		return "error: " + evaluator.Traceback(err)
+	}
+	return o.String()
+}
+
+// TestEvaluatorTests runs the tests of the evaluator on the virtual machine.
+func TestEvaluatorTests(t *testing.T) {
+	for _, test := range evaltest.All() {
+		if err := test.Check(runChecked(t, test.Code)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSameAsEvaluator(t *testing.T) {
+	tests := []string{
+		``,
+		`1 + 2 * 3 - 4 / 2`,
+		`-5 + 2.5 * 2`,
+		`!true == false`,
+		`1 < 2 && 2 <= 2 || 1 > 2`,
+		`"mankey" + " " + "bytecode"`,
+		`1 / 0`,
+		`1.0 / 0`,
+		`-true`,
+		`!1`,
+		`1 + true`,
+		`"a" - "b"`,
+		`true && 1`,
+		`false && 1`,
+		`1 || true`,
+		`false || 2`,
+		`if (1) { 2 }`,
+		`if (1 > 2) { 10 }`,
+		`if (1 < 2) { 10 } else { 20 }`,
+		`if (true) {} else { 1 }`,
+		`return 1; 2`,
+		`var x = 5; x * x`,
+		`x`,
+		`len`,
+		`var len = 3; len`,
+		`if (false) { var len = 1 }; len("four")`,
+		`var f = func(x) { var y = len; y(x) }; f("abc")`,
+		`var f = func() { len = 1 }; f()`,
+		`y = 1`,
+		`var x = 1; x += 2; x *= 3; x -= 1; x /= 2; x`,
+		`var s = "a"; s += 1`,
+		`var a = [1, 2, 3]; a[0] = 10; a[1] += 5; a`,
+		`var a = [1]; a[1] = 2`,
+		`var a = [1]; a["x"] = 2`,
+		`var h = {}; h["a"] = 1; h["a"] += 1; h["a"]`,
+		`var h = {}; h[[1]] = 1`,
+		`var n = 1; n[0] = 1`,
+		`[1, 2, 3][1]`,
+		`[1, 2, 3][3]`,
+		`[1, 2, 3][-1]`,
+		`[1, 2, 3]["a"]`,
+		`{"a": 1}["a"]`,
+		`{"a": 1}["b"]`,
+		`{"a": 1}[[1]]`,
+		`{[1]: 1}`,
+		`1[0]`,
+		`len([1, 2], 3)`,
+		`push([1], 2, 3)`,
+		`int("x")`,
+		`1(2)`,
+		`func(x) { x }`,
+		`func(x) { x }()`,
+		`func(x) { x }(1, 2)`,
+		`var add = func(a, b) { a + b }; add(1, add(2, 3))`,
+		`var f = func() { return 1; 2 }; f()`,
+		`var f = func() {}; f()`,
+		`var f = func() { if (true) { return 1 } ; 2 }; f()`,
+		`var newAdder = func(x) { func(y) { x + y } }; var addTwo = newAdder(2); addTwo(3)`,
+		`var counter = func() { var n = 0; func() { n += 1; n } }; var c = counter(); c(); c(); c()`,
+		`var f = func() { var g = func() { x }; var x = 1; g() }; f()`,
+		`var f = func() { var x = 1; var g = func() { var h = func() { x = x + 1 }; h(); h() }; g(); x }; f()`,
+		`var f = func(x) { var g = func() { x = x * 2 }; g(); x }; f(21)`,
+		`var f = func() { var fib = func(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15) }; f()`,
+		`var fs = []; for (var i = 0; i < 3; i += 1) { fs = push(fs, func() { i }) }; fs[0]()`,
+		`var f = func() { var fs = []; for (x in [1, 2, 3]) { fs = push(fs, func() { x }) }; fs[0]() + fs[2]() }; f()`,
+		`var i = 0; while (i < 10) { i += 1 }; i`,
+		`var i = 0; while (i < 10) { i += 1; if (i == 5) { break } }; i`,
+		`var s = 0; for (var i = 0; i < 10; i += 1) { if (i / 2 * 2 == i) { continue }; s += i }; s`,
+		`var s = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break }; s += x }; s`,
+		`var s = ""; for (c in "héllo") { if (c == "l") { continue }; s += c }; s`,
+		`var n = 0; for (k in {"a": 1, "b": 2}) { n += 1 }; n`,
+		`var s = ""; for (k in {"z": 1, "y": 2, "x": 3}) { s += k }; s`,
+		`var h = {"b": 1, "a": 2, "b": 3}; h["c"] = 4; h["a"] = 5; h`,
+		`var log = []; var f = func(x) { log = push(log, x); x }; {f("k1"): f(1), f("k2"): f(2)}; log`,
+		`for (x in 1) { x }`,
+		`while (1) { 1 }`,
+		`for (; 1; ) { 1 }`,
+		`var f = func() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } }; 0 }; f()`,
+		`var f = func() { var i = 0; while (true) { i += 1; if (i > 3) { return i } } }; f()`,
+		`var s = 0; for (var i = 0; i < 3; i += 1) { for (var j = 0; j < 3; j += 1) { if (j == 1) { break }; s += 1 } }; s`,
+		`var s = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { continue }; s += x * y } }; s`,
+		`var x = 1; for (x in [5, 6]) { }; x`,
+		`var a = [1, 2, 3]; for (x in a) { a = push(a, x) }; len(a)`,
+		`var f = func(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; f(3)`,
+		`var f = func(n) { if (n == 0) { 1 / 0 } else { 1 + f(n - 1) } }; var g = func() { f(2) }; g()`,
+		`var f = func(n) { 1 + f(n + 1) }; f(0)`,
+		`var loop = func(n, acc) { if (n == 0) { return acc }; loop(n - 1, acc + n) }; loop(100000, 0)`,
+		`var even = func(n) { if (n == 0) { true } else { odd(n - 1) } }; var odd = func(n) { if (n == 0) { false } else { even(n - 1) } }; even(100)`,
+		`var f = func() { 1 }; var g = f; g == f`,
+		`var f = func(a) { a }; f`,
+		`{"a": func(x) { x * 2 }}["a"](21)`,
+		`var make = func() { var h = {}; h["n"] = 0; h }; var h = make(); h["n"] += 5; h`,
+		`var x = 1; var f = func() { x += 1 }; f(); f(); x`,
+		`var f = func() { var x = if (true) { 1 } else { 2 }; x }; f()`,
+		`1 + if (true) { 2 } else { 3 } * 4`,
+		`puts; 1`,
+	}
+	for _, code := range tests {
+		program := parse(t, code)
+		want := result(evaluator.Eval(program, object.NewEnvironment()))
+		got := result(run(t, code, evaluator.DefaultLimits))
+		if got != want {
+			t.Errorf("%q: got %q; want %q", code, got, want)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := evaluator.Limits{MaxDepth: 10, MaxStringLen: 5, MaxArrayLen: 3, MaxHashLen: 2}
+	tests := []string{
+		`var f = func(n) { 1 + f(n + 1) }; f(0)`,
+		`var loop = func(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100)`,
+		`"abc" + "def"`,
+		`var s = "abc"; s += "def"`,
+		`var s = "abcdef"`,
+		`if (false) { "abcdef" } else { "abc" }`,
+		`[1, 2, 3, 4]`,
+		`push([1, 2, 3], 4)`,
+		`{1: 1, 2: 2, 3: 3}`,
+		`var h = {1: 1, 2: 2}; h[1] = 3; h[3] = 3`,
+	}
+	for _, code := range tests {
+		program := parse(t, code)
+		want := result(evaluator.EvalLimits(context.Background(), program, object.NewEnvironment(), limits))
+		got := result(run(t, code, limits))
+		if got != want {
+			t.Errorf("%q: got %q; want %q", code, got, want)
+		}
+	}
+
+	_, err := run(t, `var i = 0; while (true) { i += 1 }`, evaluator.Limits{MaxSteps: 1000})
+	if l, ok := evaluator.IsLimitExceeded(err); !ok || l.Kind != evaluator.StepLimit {
+		t.Errorf("got error %v; want a step limit error", err)
+	}
+}
+
+func TestStdout(t *testing.T) {
+	bytecode, err := compiler.Compile(parse(t, `puts(1, "a"); var f = func() { puts([2]) }; f()`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if _, err := New(bytecode).Run(evaluator.WithStdout(context.Background(), &b)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "1\na\n[2]\n"; got != want {
+		t.Fatalf("got output %q; want %q", got, want)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	tests := []string{
+		`while (true) { }`,
+		`var f = func() { f() }; f()`,
+		`var f = func() { 1 }; for (;;) { f() }`,
+	}
+	for _, code := range tests {
+		bytecode, err := compiler.Compile(parse(t, code))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = New(bytecode).Run(ctx)
+		cancel()
+		if !evaluator.IsCanceled(err) {
+			t.Errorf("%q: got error %v; want a cancellation", code, err)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	bytecode, err := compiler.Compile(parse(t, `var total = 0; for (x in input) { total += x }; total`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := New(bytecode)
+	if vm.SetGlobal("unused", object.Null) {
+		t.Errorf("SetGlobal of an unused name returned true")
+	}
+	for i, want := range []int64{6, 15} {
+		input, _ := object.FromGo([]int{i*3 + 1, i*3 + 2, i*3 + 3})
+		if !vm.SetGlobal("input", input) {
+			t.Fatalf("SetGlobal(input) returned false")
+		}
+		o, err := vm.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.String() != (&object.Integer{Value: want}).String() {
+			t.Errorf("got %v; want %v", o, want)
+		}
+		total, ok := vm.Global("total")
+		if !ok || total.String() != o.String() {
+			t.Errorf("got global total %v; want %v", total, o)
+		}
+	}
+}
+
+const fibonacci = `
+var fib = func(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+var sum = 0;
+for (var i = 0; i < 20; i += 1) { sum += fib(i) };
+sum
+`
+
+func BenchmarkEvaluator(b *testing.B) {
+	program := parse(b, fibonacci)
+	for i := 0; i < b.N; i++ {
+		if _, err := evaluator.Eval(program, object.NewEnvironment()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	bytecode, err := compiler.Compile(parse(b, fibonacci))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := New(bytecode).Run(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}